@@ -1,15 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/dmarkwat/concourse-elasticsearch/pkg/concourse"
 	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
-	elastic "github.com/elastic/go-elasticsearch/v7"
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
-func indexExists(client *elastic.Client, index string) (bool, error) {
+func indexExists(client *es.Client, index string) (bool, error) {
 	exists, err := es.IndexExists(client, index)
 	if err != nil {
 		return false, err
@@ -20,47 +23,374 @@ func indexExists(client *elastic.Client, index string) (bool, error) {
 	return true, nil
 }
 
-func getVersions(client *elastic.Client, request *concourse.CheckRequest) ([]concourse.Version, error) {
-	var document map[string]interface{}
+// remoteIndex is the hit's cluster-qualified index for cross-cluster sources so in can fetch from the right remote.
+// It's left empty for local sources to keep their versions unchanged.
+func remoteIndex(request *concourse.CheckRequest, hit es.Hit) string {
+	if es.IsRemote(request.Source.Index) {
+		return hit.Index
+	}
+	return ""
+}
+
+// hitVersion is the version of a document hit.
+func hitVersion(request *concourse.CheckRequest, hit es.Hit) concourse.Version {
+	return concourse.Version{
+		Id:      hit.ID,
+		Index:   remoteIndex(request, hit),
+		Routing: hit.Routing,
+	}
+}
+
+// firstCursor is where the first check starts from, if configured: the pinned initial version or the lookback.
+// The sort fields the cursor covers are returned with it.
+func firstCursor(client *es.Client, request *concourse.CheckRequest) (map[string]interface{}, []string, error) {
+	source := request.Source
+	if source.InitialVersion != nil {
+		if source.InitialVersion.Cursor != nil {
+			return source.InitialVersion.Cursor, source.SortFields, nil
+		}
+		document, err := es.FindById(client, source.Index, source.InitialVersion.Id, source.Routing, es.Fields{Includes: source.SortFields})
+		if err != nil {
+			return nil, nil, err
+		}
+		if document == nil {
+			return nil, nil, fmt.Errorf("initial version (%s) doesn't exist in index (%s)", source.InitialVersion.Id, source.Index)
+		}
+		return document, source.SortFields, nil
+	}
+	if source.Lookback != "" {
+		lookback, err := time.ParseDuration(source.Lookback)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the lookback applies to the first sort field, which must be a date;
+		// millisecond precision satisfies both strict_date_time and strict_date_optional_time formats
+		field := source.SortFields[0]
+		return map[string]interface{}{
+			field: time.Now().Add(-lookback).UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		}, source.SortFields[:1], nil
+	}
+	return nil, source.SortFields, nil
+}
+
+// sinceBySortFields fetches the new documents from the cursor on, deduplicated or collapsed if configured.
+func sinceBySortFields(client *es.Client, request *concourse.CheckRequest, sortFields []string, cursor *es.Cursor) ([]es.Hit, error) {
+	source := request.Source
+	if source.DedupeField != "" {
+		return es.DedupeBySortFields(client, source.Index, sortFields, source.Filter(), cursor, source.DedupeField, source.MaxVersionsPerCheck)
+	}
+	return es.SinceBySortFields(client, source.Index, sortFields, source.Filter(), cursor, source.Collapse, source.MaxVersionsPerCheck)
+}
+
+// firstVersions prepends the current version, if any, to the new versions so it's kept as the latest
+// when there are none.
+func firstVersions(request *concourse.CheckRequest, versions []concourse.Version) []concourse.Version {
+	if request.Version == nil {
+		return versions
+	}
+	return append([]concourse.Version{*request.Version}, versions...)
+}
+
+func getVersions(client *es.Client, request *concourse.CheckRequest) ([]concourse.Version, error) {
+	var hits []es.Hit
 	if request.Version != nil {
-		// initial check
-		document, err := es.FindById(client, request.Source.Index, request.Version.Id)
+		routing := request.Version.Routing
+		if routing == "" {
+			routing = request.Source.Routing
+		}
+		// only the sort fields are needed for the cursor
+		document, err := es.FindById(client, request.Source.IndexFor(request.Version), request.Version.Id, routing, es.Fields{Includes: request.Source.SortFields})
 		if err != nil {
 			return nil, err
 		}
 
 		if document == nil {
-			return nil, nil
+			// e.g. deleted; its position is lost, so carry on from the latest document as if it were the first check
+			log.Printf("Current version (%s) no longer exists; continuing from the latest document", request.Version.Id)
+			hits, err = es.LatestBySortFields(client, request.Source.Index, request.Source.SortFields, request.Source.Filter(), nil)
+			if err != nil {
+				return nil, err
+			}
+			return concourse.MapVersion(hits, func(hit es.Hit) concourse.Version {
+				return hitVersion(request, hit)
+			}), nil
+		}
+
+		// continue after the current version's document
+		hits, err = sinceBySortFields(client, request, request.Source.SortFields, &es.Cursor{
+			Values: document,
+			Id:     request.Version.Id,
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// initial check
+		cursor, sortFields, err := firstCursor(client, request)
+		if err != nil {
+			return nil, err
+		}
+
+		if request.Source.EmitAllOnFirstCheck {
+			var since *es.Cursor
+			if cursor != nil {
+				since = &es.Cursor{Values: cursor}
+			}
+			hits, err = sinceBySortFields(client, request, sortFields, since)
+		} else if cursor != nil {
+			hits, err = es.SinceBySortFields(client, request.Source.Index, sortFields, request.Source.Filter(), &es.Cursor{Values: cursor}, "", 1)
+		} else {
+			hits, err = es.LatestBySortFields(client, request.Source.Index, request.Source.SortFields, request.Source.Filter(), nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	versions := concourse.MapVersion(hits, func(hit es.Hit) concourse.Version {
+		return hitVersion(request, hit)
+	})
+	return firstVersions(request, versions), nil
+}
+
+// getRevisions emits a version per document revision when tracking updates.
+func getRevisions(client *es.Client, request *concourse.CheckRequest) ([]concourse.Version, error) {
+	revisionField := "_seq_no"
+	if request.Source.UpdatedAtField != "" {
+		revisionField = request.Source.UpdatedAtField
+	}
+
+	var cursor *es.Cursor
+	if request.Version != nil {
+		if request.Source.UpdatedAtField != "" && request.Version.UpdatedAt != "" {
+			cursor = &es.Cursor{
+				Values: map[string]interface{}{revisionField: request.Version.UpdatedAt},
+				Id:     request.Version.Id,
+			}
+		} else if request.Source.UpdatedAtField == "" && request.Version.SeqNo != "" {
+			seqNo, err := strconv.ParseInt(request.Version.SeqNo, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid seq_no in version: %s", err)
+			}
+			cursor = &es.Cursor{
+				Values: map[string]interface{}{revisionField: seqNo},
+				Id:     request.Version.Id,
+			}
 		}
 	}
 
-	ids, err := es.LatestBySortFields(client, request.Source.Index, request.Source.SortFields, document)
+	hits, err := es.LatestRevisions(client, request.Source.Index, revisionField, request.Source.Filter(), cursor, request.Source.Collapse, request.Source.MaxVersionsPerCheck)
 	if err != nil {
 		return nil, err
 	}
 
-	versions := concourse.MapVersion(ids, func(id string) concourse.Version {
-		return concourse.Version{
-			Id: id,
+	var versions []concourse.Version
+	for _, hit := range hits {
+		version := concourse.Version{
+			Id:      hit.ID,
+			Index:   remoteIndex(request, hit),
+			Routing: hit.Routing,
 		}
-	})
+		if request.Source.UpdatedAtField != "" {
+			// preserve numeric timestamps as-is for the next range query
+			var document map[string]interface{}
+			decoder := json.NewDecoder(bytes.NewReader(hit.Source))
+			decoder.UseNumber()
+			if err := decoder.Decode(&document); err != nil {
+				return nil, err
+			}
+			updatedAt, ok := document[request.Source.UpdatedAtField]
+			if !ok {
+				return nil, fmt.Errorf("field not found in doc: %s", request.Source.UpdatedAtField)
+			}
+			version.UpdatedAt = fmt.Sprint(updatedAt)
+		} else if hit.SeqNo != nil && hit.PrimaryTerm != nil {
+			version.SeqNo = strconv.FormatInt(*hit.SeqNo, 10)
+			version.PrimaryTerm = strconv.FormatInt(*hit.PrimaryTerm, 10)
+		}
+		versions = append(versions, version)
+	}
+	return firstVersions(request, versions), nil
+}
+
+// getBuckets emits a version per aggregation bucket from the current version's on, including its doc count and max
+// value when tracking changes. If the current version's bucket is gone, check continues from the latest buckets.
+func getBuckets(client *es.Client, request *concourse.CheckRequest) ([]concourse.Version, error) {
+	key := ""
+	if request.Version != nil {
+		key = request.Version.Id
+	}
+	buckets, err := es.BucketsFrom(client, request.Source.Index, request.Source.Aggregation, request.Source.Filter(), key)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" && len(buckets) == 0 {
+		log.Printf("Current version (%s) no longer exists; continuing from the latest bucket", key)
+		buckets, err = es.BucketsFrom(client, request.Source.Index, request.Source.Aggregation, request.Source.Filter(), "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	var versions []concourse.Version
+	for _, bucket := range buckets {
+		version := concourse.Version{
+			Id: bucket.Key,
+		}
+		if request.Source.Aggregation.TrackChanges {
+			version.DocCount = strconv.FormatInt(bucket.DocCount, 10)
+			version.Max = bucket.FormatMax()
+		}
+		versions = append(versions, version)
+	}
 	return versions, nil
 }
 
+// getThreshold emits a version when the threshold's condition holds over the window ending now.
+// While the condition keeps holding, a new version is emitted at most once per window.
+func getThreshold(client *es.Client, request *concourse.CheckRequest) ([]concourse.Version, error) {
+	threshold := request.Source.Threshold
+	window, err := threshold.WindowDuration()
+	if err != nil {
+		return nil, err
+	}
+	end := time.Now().UTC()
+	start := end.Add(-window)
+
+	var versions []concourse.Version
+	if request.Version != nil && request.Version.WindowEnd != "" {
+		versions = append(versions, *request.Version)
+		lastEnd, err := time.Parse(time.RFC3339Nano, request.Version.WindowEnd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window_end in version: %s", err)
+		}
+		if start.Before(lastEnd) {
+			log.Printf("Last alert's window hasn't elapsed; not evaluating until %s", lastEnd.Add(window))
+			return versions, nil
+		}
+	}
+
+	value, err := es.MetricValue(client, request.Source.Index, threshold, request.Source.Filter(), start, end)
+	if err != nil {
+		return nil, err
+	}
+	if !threshold.Exceeded(value) {
+		log.Printf("Threshold not met; %s %s %s", es.FormatValue(value), threshold.Operator, es.FormatValue(threshold.Value))
+		return versions, nil
+	}
+
+	return append(versions, concourse.Version{
+		Id:          end.Format(time.RFC3339Nano),
+		Value:       es.FormatValue(value),
+		WindowStart: start.Format(time.RFC3339Nano),
+		WindowEnd:   end.Format(time.RFC3339Nano),
+	}), nil
+}
+
+// getSnapshots emits the repository's successful snapshots from the current version onwards.
+func getSnapshots(client *es.Client, request *concourse.CheckRequest) ([]concourse.Version, error) {
+	snapshots, err := es.Snapshots(client, request.Source.SnapshotRepository)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Version != nil {
+		snapshots = es.SnapshotsSince(snapshots, request.Version.Id)
+	} else if request.Source.EmitAllOnFirstCheck {
+		snapshots = es.SuccessfulSnapshots(snapshots)
+	} else {
+		snapshots = es.SnapshotsSince(snapshots, "")
+	}
+
+	var versions []concourse.Version
+	for _, snapshot := range snapshots {
+		versions = append(versions, concourse.Version{Id: snapshot.Snapshot})
+	}
+	return versions, nil
+}
+
+// getIndices emits the indices matching the source's index, in creation order, from the current version onwards.
+// The current version is re-emitted as-is so changes to its doc count or health don't make it a new version.
+func getIndices(client *es.Client, request *concourse.CheckRequest) ([]concourse.Version, error) {
+	indices, err := es.CatIndices(client, request.Source.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []concourse.Version
+	for _, index := range indices {
+		if request.Source.Health != "" && !es.HealthAtLeast(index.Health, request.Source.Health) {
+			continue
+		}
+		created, err := strconv.ParseInt(index.CreationDate, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid creation date for index (%s): %s", index.Index, err)
+		}
+		versions = append(versions, concourse.Version{
+			Id:        index.Index,
+			CreatedAt: time.Unix(0, created*int64(time.Millisecond)).UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+			DocCount:  index.DocsCount,
+			Health:    index.Health,
+		})
+	}
+	if len(versions) == 0 {
+		return nil, nil
+	}
+
+	if request.Version == nil {
+		if request.Source.EmitAllOnFirstCheck {
+			return versions, nil
+		}
+		return versions[len(versions)-1:], nil
+	}
+	for i, version := range versions {
+		if version.Id == request.Version.Id {
+			return append([]concourse.Version{*request.Version}, versions[i+1:]...), nil
+		}
+	}
+	// the current index is gone (or unhealthy); fall back to those created since, which sort after it
+	var since []concourse.Version
+	for _, version := range versions {
+		if version.CreatedAt > request.Version.CreatedAt {
+			since = append(since, version)
+		}
+	}
+	return since, nil
+}
+
+// getHealth emits a new version only when the health's status differs from the current version's.
+func getHealth(client *es.Client, request *concourse.CheckRequest) ([]concourse.Version, error) {
+	health, err := es.Health(client, request.Source.Index, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	if request.Version != nil && request.Version.Id == health.Status {
+		return []concourse.Version{*request.Version}, nil
+	}
+
+	version := concourse.HealthVersion(health, time.Now())
+	if request.Version == nil {
+		return []concourse.Version{version}, nil
+	}
+	return []concourse.Version{*request.Version, version}, nil
+}
+
 func main() {
 	request, err := concourse.NewCheckRequest(os.Stdin)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	client, err := es.NewClient(request.Source.Addresses, request.Source.Username, request.Source.Password)
+	client, err := es.NewClient(request.Source.Addresses, request.Source.Username, request.Source.Password, request.Source.Flavor)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	exists, err := indexExists(client, request.Source.Index)
-	if err != nil {
-		log.Fatal(err)
+	exists := true
+	if request.Source.Track == "" {
+		exists, err = indexExists(client, request.Source.Index)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 	if !exists {
 		log.Println("No versions found; index doesn't exist")
@@ -71,7 +401,22 @@ func main() {
 		return
 	}
 
-	versions, err := getVersions(client, request)
+	var versions []concourse.Version
+	if request.Source.Track == concourse.TrackSnapshots {
+		versions, err = getSnapshots(client, request)
+	} else if request.Source.Track == concourse.TrackIndices {
+		versions, err = getIndices(client, request)
+	} else if request.Source.Track == concourse.TrackHealth {
+		versions, err = getHealth(client, request)
+	} else if request.Source.Threshold != nil {
+		versions, err = getThreshold(client, request)
+	} else if request.Source.Aggregation != nil {
+		versions, err = getBuckets(client, request)
+	} else if request.Source.TrackUpdates {
+		versions, err = getRevisions(client, request)
+	} else {
+		versions, err = getVersions(client, request)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
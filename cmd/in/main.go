@@ -1,96 +1,542 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/dmarkwat/concourse-elasticsearch/pkg/concourse"
 	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
-	elastic "github.com/elastic/go-elasticsearch/v7"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func main() {
-	if len(os.Args) != 2 {
-		// subtract program name
-		log.Fatalf("Expected one argument; got %d", len(os.Args)-1)
+func writeJson(file string, value interface{}) error {
+	marshal, err := json.Marshal(value)
+	if err != nil {
+		return err
 	}
 
-	outputDir := os.Args[1]
-	stat, err := os.Stat(outputDir)
+	err = ioutil.WriteFile(file, marshal, os.FileMode(0400))
 	if err != nil {
-		log.Fatalf("Error encountered checking argument: %e", err)
-	} else if !stat.IsDir() {
-		log.Fatalf("%s is not a directory", outputDir)
+		return fmt.Errorf("error encountered outputting file: %s", err)
 	}
+	return nil
+}
 
-	request, err := concourse.NewInRequest(os.Stdin)
+func getDocument(client *es.Client, request *concourse.InRequest, outputDir string) (*concourse.InResponse, error) {
+	routing := request.Version.Routing
+	if routing == "" {
+		routing = request.Source.Routing
+	}
+	index := request.Source.IndexFor(&request.Version)
+	if index != request.Source.Index {
+		// the version's concrete index may since have been deleted
+		exists, err := es.IndexExists(client, index)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return missing(request, fmt.Errorf("index (%s) doesn't exist", index))
+		}
+	}
+	fields := request.Fields()
+	if request.Params.SkipDownload {
+		// only whether the document still exists matters
+		fields = es.Fields{NoSource: true}
+	}
+	hit, err := es.FindHitById(client, index, request.Version.Id, routing, fields)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if hit == nil {
+		// missing document
+		return missing(request, fmt.Errorf("document (%s) doesn't exist in index (%s)", request.Version.Id, request.Source.Index))
+	}
+	if request.Params.SkipDownload {
+		return &concourse.InResponse{
+			Version:  request.Version,
+			Metadata: nil,
+		}, nil
+	}
+
+	document := json.RawMessage("{}")
+	if len(hit.Source) > 0 {
+		document = hit.Source
+	}
+	outFile := request.Params.Document
+	if outFile == "" {
+		outFile = request.Version.Id
+	}
+	if err := writeJson(path.Join(outputDir, outFile), document); err != nil {
+		return nil, err
+	}
+	if len(request.Params.DocvalueFields) > 0 || len(request.Params.StoredFields) > 0 {
+		fields := hit.Fields
+		if fields == nil {
+			fields = map[string]json.RawMessage{}
+		}
+		if err := writeJson(path.Join(outputDir, "fields.json"), fields); err != nil {
+			return nil, err
+		}
+	}
+
+	var metadata []concourse.Metadata
+	if request.Params.HasContext() {
+		hits, truncated, err := getContext(client, request)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeNdjson(path.Join(outputDir, "context.ndjson"), hits); err != nil {
+			return nil, err
+		}
+		metadata = append(metadata, concourse.Metadata{Name: "context", Value: strconv.Itoa(len(hits))})
+		if request.Params.Window != "" {
+			metadata = append(metadata, concourse.Metadata{Name: "context_truncated", Value: strconv.FormatBool(truncated)})
+		}
+	}
+	if len(request.Params.Search) > 0 {
+		hits, err := searchDocuments(client, request, document, outputDir)
+		if err != nil {
+			return nil, err
+		}
+		metadata = append(metadata, concourse.Metadata{Name: "search_hits", Value: strconv.Itoa(hits)})
+	}
+
+	return &concourse.InResponse{
+		Version:  request.Version,
+		Metadata: metadata,
+	}, nil
+}
+
+// getContext fetches the version's document along with its neighbours by sort order,
+// reporting whether a window's documents were truncated by its limit.
+func getContext(client *es.Client, request *concourse.InRequest) ([]es.Hit, bool, error) {
+	index := request.Source.IndexFor(&request.Version)
+	if request.Params.Window != "" {
+		window, err := time.ParseDuration(request.Params.Window)
+		if err != nil {
+			return nil, false, err
+		}
+		limit := request.Params.WindowLimit
+		if limit == 0 {
+			limit = concourse.DefaultWindowLimit
+		}
+		return es.ContextWindow(client, index, request.Source.SortFields, request.Source.Filter(), request.Version.Id, window, limit)
 	}
+	hits, err := es.Context(client, index, request.Source.SortFields, request.Source.Filter(), request.Version.Id, request.Params.Before, request.Params.After)
+	return hits, false, err
+}
 
-	cfg := elastic.Config{
-		Addresses: request.Source.Addresses,
-		Username:  request.Source.Username,
-		Password:  request.Source.Password,
+// searchDocuments runs the search rendered against the document, writing its hits and a summary.
+func searchDocuments(client *es.Client, request *concourse.InRequest, source json.RawMessage, outputDir string) (int, error) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(source, &document); err != nil {
+		return 0, err
+	}
+	query, err := concourse.RenderSearch(request.Params.Search, document)
+	if err != nil {
+		return 0, err
+	}
+	index := request.Params.SearchIndex
+	if index == "" {
+		index = request.Source.Index
+	}
+	sortFields := request.Params.SearchSort
+	if len(sortFields) == 0 {
+		sortFields = request.Source.SortFields
+	}
+	limit := request.Params.SearchLimit
+	if limit == 0 {
+		limit = concourse.DefaultSearchLimit
 	}
 
-	client, err := elastic.NewClient(cfg)
+	// one more than the limit tells whether any were left out
+	hits, err := es.Search(client, index, query, sortFields, es.Fields{}, limit+1)
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
+	}
+	truncated := len(hits) > limit
+	if truncated {
+		hits = hits[:limit]
+	}
+	if err := writeNdjson(path.Join(outputDir, "search.ndjson"), hits); err != nil {
+		return 0, err
+	}
+	summary := map[string]interface{}{
+		"index":     index,
+		"query":     query,
+		"hits":      len(hits),
+		"limit":     limit,
+		"truncated": truncated,
+	}
+	if err := writeJson(path.Join(outputDir, "search.json"), summary); err != nil {
+		return 0, err
+	}
+	return len(hits), nil
+}
+
+// writeNdjson writes each hit's source on its own line.
+func writeNdjson(file string, hits []es.Hit) error {
+	var buf bytes.Buffer
+	if err := concourse.WriteNdjson(&buf, hits); err != nil {
+		return err
 	}
 
-	info, err := client.Info()
+	err := ioutil.WriteFile(file, buf.Bytes(), os.FileMode(0400))
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("error encountered outputting file: %s", err)
 	}
-	log.Println(info)
+	return nil
+}
 
-	exists, err := es.IndexExists(client, request.Source.Index)
+// exportDocuments writes every document matched by the source in the export's format.
+func exportDocuments(client *es.Client, request *concourse.InRequest, outputDir string) (*concourse.InResponse, error) {
+	export := request.Params.Export
+	fields := request.Fields()
+	if export.Format == concourse.ExportCsv || export.Format == concourse.ExportParquet {
+		// only the columns are needed
+		fields.Includes = export.Columns
+		fields.Excludes = nil
+	}
+	file, err := os.OpenFile(path.Join(outputDir, export.FileName()), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(0400))
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("error encountered outputting file: %s", err)
 	}
-	if !exists {
-		log.Fatalf("Index (%s) doesn't exist", request.Source.Index)
+	defer file.Close()
+	buffered := bufio.NewWriter(file)
+	writer := concourse.NewExportWriter(buffered, export)
+
+	// each page is written as it's read, so exports needn't fit in memory
+	exported := 0
+	err = es.SearchPages(client, request.Source.Index, request.Source.Filter().Clause(), request.Source.SortFields, fields, export.Limit, func(hits []es.Hit) error {
+		exported += len(hits)
+		return writer.Write(hits)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
 	}
+	if err := buffered.Flush(); err != nil {
+		return nil, fmt.Errorf("error encountered outputting file: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("error encountered outputting file: %s", err)
+	}
+
+	return &concourse.InResponse{
+		Version: request.Version,
+		Metadata: []concourse.Metadata{
+			{Name: "exported", Value: strconv.Itoa(exported)},
+		},
+	}, nil
+}
+
+// missing fails with the error unless missing versions are to be ignored, in which case the version is emitted as is.
+func missing(request *concourse.InRequest, err error) (*concourse.InResponse, error) {
+	if request.Params.Missing != concourse.MissingIgnore {
+		return nil, err
+	}
+	log.Print(err)
+	return &concourse.InResponse{
+		Version: request.Version,
+		Metadata: []concourse.Metadata{
+			{Name: "missing", Value: "true"},
+		},
+	}, nil
+}
 
-	document, err := es.FindById(client, request.Source.Index, request.Version.Id)
+// getSnapshot writes the snapshot identified by the version.
+func getSnapshot(client *es.Client, request *concourse.InRequest, outputDir string) (*concourse.InResponse, error) {
+	snapshots, err := es.Snapshots(client, request.Source.SnapshotRepository, request.Version.Id)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return missing(request, fmt.Errorf("snapshot (%s) doesn't exist in repository (%s)", request.Version.Id, request.Source.SnapshotRepository))
+	}
+	snapshot := snapshots[0]
+	metadata := []concourse.Metadata{
+		{Name: "state", Value: snapshot.State},
+		{Name: "indices", Value: strings.Join(snapshot.Indices, ",")},
+	}
+	if request.Params.SkipDownload {
+		return &concourse.InResponse{
+			Version:  request.Version,
+			Metadata: metadata,
+		}, nil
 	}
-	if document != nil {
-		var outFile string
-		if request.Params.Document == "" {
-			outFile = path.Join(outputDir, request.Version.Id)
-		} else {
-			outFile = request.Params.Document
-		}
 
-		marshal, err := json.Marshal(document)
-		if err != nil {
-			log.Fatal(err)
+	outFile := request.Params.Document
+	if outFile == "" {
+		outFile = "snapshot.json"
+	}
+	if err := writeJson(path.Join(outputDir, outFile), snapshot); err != nil {
+		return nil, err
+	}
+
+	return &concourse.InResponse{
+		Version:  request.Version,
+		Metadata: metadata,
+	}, nil
+}
+
+// getIndex writes the settings, mappings and stats of the index identified by the version.
+func getIndex(client *es.Client, request *concourse.InRequest, outputDir string) (*concourse.InResponse, error) {
+	details, err := es.GetIndexDetails(client, request.Version.Id)
+	if err != nil {
+		return nil, err
+	}
+	if details == nil {
+		return missing(request, fmt.Errorf("index (%s) doesn't exist", request.Version.Id))
+	}
+	metadata := []concourse.Metadata{
+		{Name: "created_at", Value: request.Version.CreatedAt},
+		{Name: "doc_count", Value: request.Version.DocCount},
+		{Name: "health", Value: request.Version.Health},
+	}
+	if request.Params.SkipDownload {
+		return &concourse.InResponse{
+			Version:  request.Version,
+			Metadata: metadata,
+		}, nil
+	}
+
+	for file, contents := range map[string]json.RawMessage{
+		"settings.json": details.Settings,
+		"mappings.json": details.Mappings,
+		"stats.json":    details.Stats,
+	} {
+		if err := writeJson(path.Join(outputDir, file), contents); err != nil {
+			return nil, err
 		}
+	}
+
+	return &concourse.InResponse{
+		Version:  request.Version,
+		Metadata: metadata,
+	}, nil
+}
+
+// getHealth writes the health recorded in the version, as of when it was observed, along with the cluster's info.
+func getHealth(client *es.Client, request *concourse.InRequest, outputDir string) (*concourse.InResponse, error) {
+	health, err := versionHealth(request.Version)
+	if err != nil {
+		return nil, err
+	}
+	metadata := healthMetadata(client, health)
+	if request.Params.SkipDownload {
+		return &concourse.InResponse{
+			Version:  request.Version,
+			Metadata: metadata,
+		}, nil
+	}
 
-		err = ioutil.WriteFile(outFile, marshal, os.FileMode(0400))
+	outFile := request.Params.Document
+	if outFile == "" {
+		outFile = "health.json"
+	}
+	contents := map[string]interface{}{
+		"health":  health,
+		"cluster": client.Info,
+	}
+	if err := writeJson(path.Join(outputDir, outFile), contents); err != nil {
+		return nil, err
+	}
+
+	return &concourse.InResponse{
+		Version:  request.Version,
+		Metadata: metadata,
+	}, nil
+}
+
+// versionHealth reads the health recorded in the version.
+func versionHealth(version concourse.Version) (map[string]interface{}, error) {
+	health := map[string]interface{}{
+		"status":      version.Id,
+		"observed_at": version.ObservedAt,
+	}
+	for name, value := range map[string]string{
+		"active_shards":     version.ActiveShards,
+		"unassigned_shards": version.UnassignedShards,
+	} {
+		count, err := strconv.Atoi(value)
 		if err != nil {
-			log.Fatalf("Error encountered outputting file: %e", err)
+			return nil, fmt.Errorf("invalid %s in version: %s", name, err)
 		}
+		health[name] = count
+	}
+	return health, nil
+}
+
+func healthMetadata(client *es.Client, health map[string]interface{}) []concourse.Metadata {
+	metadata := []concourse.Metadata{
+		{Name: "cluster", Value: client.Info.Name},
+		{Name: "version", Value: client.Info.Version.Number},
+	}
+	for _, name := range []string{"status", "observed_at", "active_shards", "unassigned_shards"} {
+		metadata = append(metadata, concourse.Metadata{Name: name, Value: fmt.Sprint(health[name])})
+	}
+	return metadata
+}
 
-		response := concourse.InResponse{
+// getBucket writes the aggregation bucket identified by the version along with its top hits.
+func getBucket(client *es.Client, request *concourse.InRequest, outputDir string) (*concourse.InResponse, error) {
+	buckets, err := es.Buckets(client, request.Source.Index, request.Source.Aggregation, request.Source.Filter(), request.Version.Id)
+	if err != nil {
+		return nil, err
+	}
+	if len(buckets) == 0 {
+		return missing(request, fmt.Errorf("bucket (%s) doesn't exist in index (%s)", request.Version.Id, request.Source.Index))
+	}
+	bucket := buckets[0]
+	metadata := []concourse.Metadata{
+		{Name: "key", Value: bucket.Key},
+		{Name: "doc_count", Value: strconv.FormatInt(bucket.DocCount, 10)},
+	}
+	if request.Params.SkipDownload {
+		return &concourse.InResponse{
 			Version:  request.Version,
-			Metadata: nil,
-		}
-		marshal, err = json.Marshal(response)
+			Metadata: metadata,
+		}, nil
+	}
+
+	topHits := make([]json.RawMessage, len(bucket.TopHits))
+	for i, hit := range bucket.TopHits {
+		topHits[i] = hit.Source
+	}
+	contents := map[string]interface{}{
+		"key":       bucket.Key,
+		"doc_count": bucket.DocCount,
+		"top_hits":  topHits,
+	}
+	if bucket.Max != nil {
+		contents["max"] = *bucket.Max
+	}
+
+	outFile := request.Params.Document
+	if outFile == "" {
+		outFile = "bucket.json"
+	}
+	if err := writeJson(path.Join(outputDir, outFile), contents); err != nil {
+		return nil, err
+	}
+
+	return &concourse.InResponse{
+		Version:  request.Version,
+		Metadata: metadata,
+	}, nil
+}
+
+// getThreshold writes the alert carried by the version; nothing is fetched as the version is the alert.
+func getThreshold(request *concourse.InRequest, outputDir string) (*concourse.InResponse, error) {
+	metadata := []concourse.Metadata{
+		{Name: "value", Value: request.Version.Value},
+		{Name: "window_start", Value: request.Version.WindowStart},
+		{Name: "window_end", Value: request.Version.WindowEnd},
+	}
+	if request.Params.SkipDownload {
+		return &concourse.InResponse{
+			Version:  request.Version,
+			Metadata: metadata,
+		}, nil
+	}
+
+	threshold := request.Source.Threshold
+	metric := threshold.Metric
+	if metric == "" {
+		metric = es.MetricCount
+	}
+	contents := map[string]interface{}{
+		"metric":       metric,
+		"field":        threshold.Field,
+		"operator":     threshold.Operator,
+		"threshold":    threshold.Value,
+		"value":        request.Version.Value,
+		"window_start": request.Version.WindowStart,
+		"window_end":   request.Version.WindowEnd,
+	}
+
+	outFile := request.Params.Document
+	if outFile == "" {
+		outFile = "threshold.json"
+	}
+	if err := writeJson(path.Join(outputDir, outFile), contents); err != nil {
+		return nil, err
+	}
+
+	return &concourse.InResponse{
+		Version:  request.Version,
+		Metadata: metadata,
+	}, nil
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		// subtract program name
+		log.Fatalf("Expected one argument; got %d", len(os.Args)-1)
+	}
+
+	outputDir := os.Args[1]
+	stat, err := os.Stat(outputDir)
+	if err != nil {
+		log.Fatalf("Error encountered checking argument: %e", err)
+	} else if !stat.IsDir() {
+		log.Fatalf("%s is not a directory", outputDir)
+	}
+
+	request, err := concourse.NewInRequest(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client, err := es.NewClient(request.Source.Addresses, request.Source.Username, request.Source.Password, request.Source.Flavor)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exists := true
+	if request.Source.Track == "" {
+		exists, err = es.IndexExists(client, request.Source.Index)
 		if err != nil {
 			log.Fatal(err)
 		}
+	}
 
-		if _, err := os.Stdout.Write(marshal); err != nil {
-			log.Fatal(err)
-		}
+	var response *concourse.InResponse
+	if !exists {
+		response, err = missing(request, fmt.Errorf("index (%s) doesn't exist", request.Source.Index))
+	} else if request.Source.Track == concourse.TrackSnapshots {
+		response, err = getSnapshot(client, request, outputDir)
+	} else if request.Source.Track == concourse.TrackIndices {
+		response, err = getIndex(client, request, outputDir)
+	} else if request.Source.Track == concourse.TrackHealth {
+		response, err = getHealth(client, request, outputDir)
+	} else if request.Source.Threshold != nil {
+		response, err = getThreshold(request, outputDir)
+	} else if request.Source.Aggregation != nil {
+		response, err = getBucket(client, request, outputDir)
+	} else if request.Params.Export != nil {
+		response, err = exportDocuments(client, request, outputDir)
 	} else {
-		// missing document
-		log.Fatalf("Document (%s) doesn't exist in index (%s)", request.Version.Id, request.Source.Index)
+		response, err = getDocument(client, request, outputDir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	marshal, err := json.Marshal(response)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := os.Stdout.Write(marshal); err != nil {
+		log.Fatal(err)
 	}
 }
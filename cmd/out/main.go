@@ -1,111 +1,480 @@
 package main
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	concourse "github.com/dmarkwat/concourse-elasticsearch/pkg/concourse"
 	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
-	elastic "github.com/elastic/go-elasticsearch/v7"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func main() {
-	if len(os.Args) != 2 {
-		// subtract program name
-		log.Fatalf("Expected one argument; got %d", len(os.Args)-1)
+func routingFor(request *concourse.OutRequest) string {
+	if request.Params.Routing != "" {
+		return request.Params.Routing
 	}
+	return request.Source.Routing
+}
 
-	inputDir := os.Args[1]
-	stat, err := os.Stat(inputDir)
+// queryVersion derives a stable version from a query so repeated by-query puts yield the same version.
+func queryVersion(query map[string]interface{}) (string, error) {
+	marshal, err := json.Marshal(query)
 	if err != nil {
-		log.Fatalf("Error encountered checking argument: %e", err)
-	} else if !stat.IsDir() {
-		log.Fatalf("%s is not a directory", inputDir)
+		return "", err
 	}
+	sum := sha256.Sum256(marshal)
+	return base64.URLEncoding.EncodeToString(sum[:]), nil
+}
 
-	request, err := concourse.NewOutRequest(os.Stdin)
+func indexDocument(client *es.Client, request *concourse.OutRequest, inputDir string) (*concourse.OutResponse, error) {
+	exists, err := es.IndexExists(client, request.Source.Index)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	if !exists {
+		log.Printf("Index (%s) doesn't exist; creating...", request.Source.Index)
 
-	cfg := elastic.Config{
-		Addresses: request.Source.Addresses,
-		Username:  request.Source.Username,
-		Password:  request.Source.Password,
+		err := es.CreateIndex(client, request.Source.Index, request.Params.FieldMap, request.Source.SortFields)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	client, err := elastic.NewClient(cfg)
+	var fileBytes []byte
+	if request.Params.Document != "" {
+		fileBytes, err = ioutil.ReadFile(path.Join(inputDir, request.Params.Document))
+	} else {
+		fileBytes, err = concourse.RenderDocument(inputDir, request.Params, concourse.NewBuildMetadata())
+	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	info, err := client.Info()
+	var fileJson map[string]interface{}
+	err = json.Unmarshal(fileBytes, &fileJson)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	log.Println(info)
 
-	exists, err := es.IndexExists(client, request.Source.Index)
+	sum, err := concourse.DocumentId(fileJson, request.Source.SortFields)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	if !exists {
-		log.Printf("Index (%s) doesn't exist; creating...", request.Source.Index)
 
-		err := es.CreateIndex(client, request.Source.Index, request.Params.FieldMap, request.Source.SortFields)
+	if request.Params.Enrich != nil {
+		concourse.Enrich(fileJson, request.Params.Enrich.Key, concourse.NewBuildMetadata(), time.Now())
+		fileBytes, err = json.Marshal(fileJson)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 	}
 
-	fileBytes, err := ioutil.ReadFile(path.Join(inputDir, request.Params.Document))
+	routing := routingFor(request)
+	written, err := es.CreateDocument(client, request.Source.Index, sum, fileBytes, routing, request.Params.Pipeline, request.Params.Refresh, request.Params.WaitForActiveShards)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	version := concourse.Version{
+		Id:      sum,
+		Routing: routing,
+	}
+	if written == nil {
+		log.Print("Document already exists; not updating")
+	} else if request.Source.TrackUpdates {
+		if request.Source.UpdatedAtField != "" {
+			switch updatedAt := fileJson[request.Source.UpdatedAtField].(type) {
+			case nil:
+			case string:
+				version.UpdatedAt = updatedAt
+			default:
+				// numbers must be kept out of exponent notation to be usable as a range cursor
+				marshal, err := json.Marshal(updatedAt)
+				if err != nil {
+					return nil, err
+				}
+				version.UpdatedAt = string(marshal)
+			}
+		} else {
+			version.SeqNo = strconv.FormatInt(written.SeqNo, 10)
+			version.PrimaryTerm = strconv.FormatInt(written.PrimaryTerm, 10)
+		}
 	}
 
-	var fileJson map[string]interface{}
-	err = json.Unmarshal(fileBytes, &fileJson)
+	return &concourse.OutResponse{
+		Version:  version,
+		Metadata: nil,
+	}, nil
+}
+
+func deleteDocuments(client *es.Client, request *concourse.OutRequest) (*concourse.OutResponse, error) {
+	routing := routingFor(request)
+	if request.Params.Id != "" {
+		found, err := es.DeleteById(client, request.Source.Index, request.Params.Id, routing, request.Params.Refresh)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			log.Printf("Document (%s) already deleted", request.Params.Id)
+		}
+		return &concourse.OutResponse{
+			Version: concourse.Version{
+				Id:      request.Params.Id,
+				Routing: routing,
+			},
+			Metadata: []concourse.Metadata{
+				{Name: "deleted", Value: strconv.FormatBool(found)},
+			},
+		}, nil
+	}
+
+	id, err := queryVersion(request.Params.Query)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	deleted, err := es.DeleteByQuery(client, request.Source.Index, request.Params.Query, refreshByQuery(request.Params.Refresh))
+	if err != nil {
+		return nil, err
 	}
+	return &concourse.OutResponse{
+		Version: concourse.Version{
+			Id: id,
+		},
+		Metadata: []concourse.Metadata{
+			{Name: "deleted", Value: strconv.Itoa(deleted)},
+		},
+	}, nil
+}
 
-	digest := sha256.New()
-	for _, field := range request.Source.SortFields {
-		if _, ok := fileJson[field]; ok {
-			log.Fatalf("Sort field, %s, missing from document", field)
+func tombstoneDocuments(client *es.Client, request *concourse.OutRequest) (*concourse.OutResponse, error) {
+	routing := routingFor(request)
+	if request.Params.Id != "" {
+		err := es.TombstoneById(client, request.Source.Index, request.Params.Id, routing, request.Source.TombstoneField, request.Params.Refresh)
+		if err != nil {
+			return nil, err
 		}
-		value, ok := fileJson[field].(string)
-		if ok {
-			log.Fatalf("%s must be a string", field)
+		return &concourse.OutResponse{
+			Version: concourse.Version{
+				Id:      request.Params.Id,
+				Routing: routing,
+			},
+			Metadata: []concourse.Metadata{
+				{Name: "tombstoned", Value: "1"},
+			},
+		}, nil
+	}
+
+	id, err := queryVersion(request.Params.Query)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := es.TombstoneByQuery(client, request.Source.Index, request.Params.Query, request.Source.TombstoneField, refreshByQuery(request.Params.Refresh))
+	if err != nil {
+		return nil, err
+	}
+	return &concourse.OutResponse{
+		Version: concourse.Version{
+			Id: id,
+		},
+		Metadata: []concourse.Metadata{
+			{Name: "tombstoned", Value: strconv.Itoa(updated)},
+		},
+	}, nil
+}
+
+// reindexDocuments copies the source's index into a new index with the params' sort fields, verifying every document
+// made it across before optionally moving an alias to the new index.
+func reindexDocuments(client *es.Client, request *concourse.OutRequest) (*concourse.OutResponse, error) {
+	source := request.Source.Index
+	dest := request.Params.Dest
+	exists, err := es.IndexExists(client, dest)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		log.Printf("Index (%s) already exists; reindexing into it as-is", dest)
+	} else {
+		sortFields := request.Params.DestSortFields
+		if len(sortFields) == 0 {
+			sortFields = request.Source.SortFields
 		}
-		_, err := digest.Write([]byte(value))
-		if err != nil {
-			log.Fatalf("Error adding to digest: %e", err)
+		if err := es.CreateIndexFrom(client, dest, source, request.Params.FieldMap, sortFields); err != nil {
+			return nil, err
 		}
 	}
 
-	sum := base64.URLEncoding.EncodeToString(digest.Sum(nil))
+	timeout := request.Params.Timeout
+	if timeout == "" {
+		timeout = concourse.DefaultReindexTimeout
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, err
+	}
 
-	create, err := client.Create(request.Source.Index, sum, bytes.NewReader(fileBytes))
+	// counted beforehand, as the reindex copies the source as of its start
+	sourceCount, err := es.Count(client, source)
 	if err != nil {
-		log.Fatalf("Error creating document")
+		return nil, err
 	}
-	if create.StatusCode == 409 {
-		log.Print("Document already exists; not updating")
-		os.Exit(0)
+	reindexed, err := es.Reindex(client, source, dest, duration)
+	if err != nil {
+		return nil, err
+	}
+	// the destination may already hold other documents, so only those the reindex wrote are compared
+	if reindexed != sourceCount {
+		return nil, fmt.Errorf("%d of %d documents in %s were reindexed into %s", reindexed, sourceCount, source, dest)
 	}
 
-	response := concourse.OutResponse{
+	metadata := []concourse.Metadata{
+		{Name: "reindexed", Value: strconv.Itoa(reindexed)},
+		{Name: "documents", Value: strconv.Itoa(sourceCount)},
+	}
+	if request.Params.Alias != "" {
+		if err := es.MoveAlias(client, request.Params.Alias, dest); err != nil {
+			return nil, err
+		}
+		metadata = append(metadata, concourse.Metadata{Name: "alias", Value: request.Params.Alias})
+	}
+	return &concourse.OutResponse{
 		Version: concourse.Version{
-			Id: sum,
+			Id: dest,
 		},
-		Metadata: nil,
+		Metadata: metadata,
+	}, nil
+}
+
+// updateAlias adds, removes or swaps the alias, emitting the indices it then points to.
+func updateAlias(client *es.Client, request *concourse.OutRequest) (*concourse.OutResponse, error) {
+	alias := request.Params.Alias
+	indices := request.Params.Indices
+	if len(indices) == 0 && request.Params.Action != concourse.ActionRemoveAlias {
+		indices = []string{request.Source.Index}
+	}
+
+	var err error
+	switch request.Params.Action {
+	case concourse.ActionAddAlias:
+		var actions []es.AliasAction
+		for _, index := range indices {
+			actions = append(actions, es.AddAlias(index, alias))
+		}
+		err = es.UpdateAliases(client, actions)
+	case concourse.ActionRemoveAlias:
+		if len(indices) == 0 {
+			indices, err = es.AliasIndices(client, alias)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var actions []es.AliasAction
+		for _, index := range indices {
+			actions = append(actions, es.RemoveAlias(index, alias))
+		}
+		if len(actions) == 0 {
+			log.Printf("Alias (%s) already removed", alias)
+		} else {
+			err = es.UpdateAliases(client, actions)
+		}
+	case concourse.ActionSwapAlias:
+		err = es.MoveAlias(client, alias, indices...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := es.AliasIndices(client, alias)
+	if err != nil {
+		return nil, err
+	}
+	id := strings.Join(current, ",")
+	if id == "" {
+		id = alias
+	}
+	return &concourse.OutResponse{
+		Version: concourse.Version{
+			Id: id,
+		},
+		Metadata: []concourse.Metadata{
+			{Name: "alias", Value: alias},
+			{Name: "indices", Value: strings.Join(current, ",")},
+		},
+	}, nil
+}
+
+// rolloverAlias rolls the write alias over if its conditions are met, emitting the alias's resulting write index.
+func rolloverAlias(client *es.Client, request *concourse.OutRequest) (*concourse.OutResponse, error) {
+	rollover, err := es.Rollover(client, request.Params.Alias, request.Params.Conditions, request.Params.NewIndex)
+	if err != nil {
+		return nil, err
+	}
+	index := rollover.OldIndex
+	if rollover.RolledOver {
+		index = rollover.NewIndex
+	}
+	return &concourse.OutResponse{
+		Version: concourse.Version{
+			Id: index,
+		},
+		Metadata: []concourse.Metadata{
+			{Name: "alias", Value: request.Params.Alias},
+			{Name: "index", Value: index},
+			{Name: "rolled_over", Value: strconv.FormatBool(rollover.RolledOver)},
+			{Name: "old_index", Value: rollover.OldIndex},
+		},
+	}, nil
+}
+
+// waitForHealth blocks until the cluster, or the source's index, is at least the required health or the timeout passes.
+func waitForHealth(client *es.Client, request *concourse.OutRequest) (*concourse.OutResponse, error) {
+	required := request.Params.Health
+	if required == "" {
+		required = es.HealthGreen
+	}
+	timeout := request.Params.Timeout
+	if timeout == "" {
+		timeout = concourse.DefaultHealthTimeout
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Waiting up to %s for %s health", timeout, required)
+	health, err := es.Health(client, request.Source.Index, required, duration)
+	if err != nil {
+		return nil, err
+	}
+	if health.TimedOut {
+		return nil, fmt.Errorf("timed out after %s waiting for %s health; health is %s", timeout, required, health.Status)
+	}
+	// shaped like check's version so that, becoming the current version, check continues from it
+	return &concourse.OutResponse{
+		Version: concourse.HealthVersion(health, time.Now()),
+		Metadata: []concourse.Metadata{
+			{Name: "cluster", Value: client.Info.Name},
+			{Name: "status", Value: health.Status},
+			{Name: "active_shards", Value: strconv.Itoa(health.ActiveShards)},
+			{Name: "unassigned_shards", Value: strconv.Itoa(health.UnassignedShards)},
+		},
+	}, nil
+}
+
+// snapshotIndices snapshots the params' indices, or else the source's index, into the source's repository.
+func snapshotIndices(client *es.Client, request *concourse.OutRequest) (*concourse.OutResponse, error) {
+	name := request.Params.Snapshot
+	if name == "" {
+		name = "snapshot-" + time.Now().UTC().Format("2006.01.02-15.04.05")
+	}
+	indices := request.Params.Indices
+	if len(indices) == 0 && request.Source.Index != "" {
+		indices = []string{request.Source.Index}
+	}
+
+	snapshot, err := es.CreateSnapshot(client, request.Source.SnapshotRepository, name, indices, request.Params.WaitForCompletion)
+	if err != nil {
+		return nil, err
+	}
+	return &concourse.OutResponse{
+		Version: concourse.Version{
+			Id: name,
+		},
+		Metadata: snapshotMetadata(request.Source.SnapshotRepository, snapshot),
+	}, nil
+}
+
+// restoreSnapshot restores the params' snapshot from the source's repository.
+func restoreSnapshot(client *es.Client, request *concourse.OutRequest) (*concourse.OutResponse, error) {
+	params := request.Params
+	snapshot, err := es.RestoreSnapshot(client, request.Source.SnapshotRepository, params.Snapshot, params.Indices, params.RenamePattern, params.RenameReplacement, params.WaitForCompletion)
+	if err != nil {
+		return nil, err
 	}
+	return &concourse.OutResponse{
+		Version: concourse.Version{
+			Id: params.Snapshot,
+		},
+		Metadata: snapshotMetadata(request.Source.SnapshotRepository, snapshot),
+	}, nil
+}
+
+// snapshotMetadata describes the snapshot, which is only known when waiting for completion.
+func snapshotMetadata(repository string, snapshot *es.Snapshot) []concourse.Metadata {
+	metadata := []concourse.Metadata{
+		{Name: "repository", Value: repository},
+	}
+	if snapshot == nil {
+		return metadata
+	}
+	if snapshot.State != "" {
+		metadata = append(metadata, concourse.Metadata{Name: "state", Value: snapshot.State})
+	}
+	return append(metadata,
+		concourse.Metadata{Name: "indices", Value: strings.Join(snapshot.Indices, ",")},
+		concourse.Metadata{Name: "shards", Value: strconv.Itoa(snapshot.Shards.Successful)},
+	)
+}
+
+// refreshByQuery maps the refresh param onto the by-query APIs, which don't support wait_for.
+func refreshByQuery(refresh string) bool {
+	return refresh == "true" || refresh == "wait_for"
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		// subtract program name
+		log.Fatalf("Expected one argument; got %d", len(os.Args)-1)
+	}
+
+	inputDir := os.Args[1]
+	stat, err := os.Stat(inputDir)
+	if err != nil {
+		log.Fatalf("Error encountered checking argument: %e", err)
+	} else if !stat.IsDir() {
+		log.Fatalf("%s is not a directory", inputDir)
+	}
+
+	request, err := concourse.NewOutRequest(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client, err := es.NewClient(request.Source.Addresses, request.Source.Username, request.Source.Password, request.Source.Flavor)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var response *concourse.OutResponse
+	switch request.Params.Action {
+	case concourse.ActionDelete:
+		response, err = deleteDocuments(client, request)
+	case concourse.ActionTombstone:
+		response, err = tombstoneDocuments(client, request)
+	case concourse.ActionSnapshot:
+		response, err = snapshotIndices(client, request)
+	case concourse.ActionRestore:
+		response, err = restoreSnapshot(client, request)
+	case concourse.ActionReindex:
+		response, err = reindexDocuments(client, request)
+	case concourse.ActionAddAlias, concourse.ActionRemoveAlias, concourse.ActionSwapAlias:
+		response, err = updateAlias(client, request)
+	case concourse.ActionRollover:
+		response, err = rolloverAlias(client, request)
+	case concourse.ActionWaitForHealth:
+		response, err = waitForHealth(client, request)
+	default:
+		response, err = indexDocument(client, request, inputDir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	marshal, err := json.Marshal(response)
 	if err != nil {
 		log.Fatal(err)
@@ -3,16 +3,81 @@ package concourse
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
 	"io"
+	"time"
 )
 
 func validateSource(source *SourceConfig) error {
-	if source.Index == "" {
+	if source.Index == "" && source.Track != TrackSnapshots && source.Track != TrackHealth {
 		return fmt.Errorf("invalid source config: index required")
 	} else if len(source.Addresses) == 0 {
 		return fmt.Errorf("invalid source config: addresses required")
-	} else if len(source.SortFields) == 0 {
+	} else if source.Flavor != "" && source.Flavor != es.FlavorElasticsearch && source.Flavor != es.FlavorOpenSearch {
+		return fmt.Errorf("invalid source config: invalid flavor: %s", source.Flavor)
+	} else if len(source.SortFields) == 0 && source.Aggregation == nil && source.Threshold == nil && source.Track == "" {
 		return fmt.Errorf("invalid source config: sort_fields required")
+	} else if source.UpdatedAtField != "" && !source.TrackUpdates {
+		return fmt.Errorf("invalid source config: updated_at_field requires track_updates")
+	}
+	if source.InitialVersion != nil {
+		if (source.InitialVersion.Id == "") == (source.InitialVersion.Cursor == nil) {
+			return fmt.Errorf("invalid source config: initial_version requires one of id or cursor")
+		} else if source.Lookback != "" {
+			return fmt.Errorf("invalid source config: only one of initial_version or lookback may be set")
+		}
+	}
+	if source.Lookback != "" {
+		if _, err := time.ParseDuration(source.Lookback); err != nil {
+			return fmt.Errorf("invalid source config: invalid lookback: %s", err)
+		}
+	}
+
+	if source.MaxVersionsPerCheck < 0 {
+		return fmt.Errorf("invalid source config: max_versions_per_check must not be negative")
+	}
+
+	if source.Collapse != "" && source.DedupeField != "" {
+		return fmt.Errorf("invalid source config: only one of collapse or dedupe_field may be set")
+	} else if source.DedupeField != "" && (source.TrackUpdates || source.Aggregation != nil || source.Threshold != nil) {
+		return fmt.Errorf("invalid source config: dedupe_field only applies to tracking documents by sort_fields")
+	}
+
+	modes := 0
+	for _, mode := range []bool{source.TrackUpdates, source.Aggregation != nil, source.Threshold != nil, source.Track != ""} {
+		if mode {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("invalid source config: only one of track_updates, aggregation, threshold or track may be set")
+	}
+	switch source.Track {
+	case "":
+	case TrackSnapshots:
+		if source.SnapshotRepository == "" {
+			return fmt.Errorf("invalid source config: snapshot_repository required to track %s", source.Track)
+		}
+	case TrackIndices, TrackHealth:
+	default:
+		return fmt.Errorf("invalid source config: invalid track: %s", source.Track)
+	}
+	if source.Health != "" {
+		if source.Track != TrackIndices {
+			return fmt.Errorf("invalid source config: health only applies to tracking %s", TrackIndices)
+		} else if !es.ValidHealth(source.Health) {
+			return fmt.Errorf("invalid source config: invalid health: %s", source.Health)
+		}
+	}
+	if source.Aggregation != nil {
+		if err := source.Aggregation.Validate(); err != nil {
+			return fmt.Errorf("invalid source config: %s", err)
+		}
+	}
+	if source.Threshold != nil {
+		if err := source.Threshold.Validate(); err != nil {
+			return fmt.Errorf("invalid source config: %s", err)
+		}
 	}
 	return nil
 }
@@ -38,13 +103,72 @@ func NewInRequest(reader io.Reader) (*InRequest, error) {
 	if err != nil {
 		return nil, err
 	}
+	if request.Params == nil {
+		request.Params = &InParams{}
+	}
 
 	err = validateSource(&request.Source)
 	if err != nil {
 		return nil, err
-	} else {
-		return &request, nil
 	}
+
+	switch request.Params.Missing {
+	case "", MissingFail, MissingIgnore:
+	default:
+		return nil, fmt.Errorf("invalid missing: %s", request.Params.Missing)
+	}
+	if request.Params.SkipDownload && (request.Params.HasContext() || len(request.Params.Search) > 0) {
+		return nil, fmt.Errorf("skip_download can't be combined with before, after, window or search")
+	}
+	if request.Params.Before < 0 || request.Params.After < 0 {
+		return nil, fmt.Errorf("before and after must not be negative")
+	}
+	if request.Params.Window != "" {
+		if request.Params.Before > 0 || request.Params.After > 0 {
+			return nil, fmt.Errorf("window can't be combined with before or after")
+		}
+		if _, err := time.ParseDuration(request.Params.Window); err != nil {
+			return nil, fmt.Errorf("invalid window: %s", err)
+		}
+	} else if request.Params.WindowLimit != 0 {
+		return nil, fmt.Errorf("window_limit requires window")
+	}
+	if request.Params.WindowLimit < 0 {
+		return nil, fmt.Errorf("window_limit must not be negative")
+	}
+	if request.Params.HasContext() && !request.Source.TracksDocuments() {
+		return nil, fmt.Errorf("before, after and window are only supported for documents")
+	}
+	if len(request.Params.Search) > 0 {
+		if !request.Source.TracksDocuments() {
+			return nil, fmt.Errorf("search is only supported for documents")
+		}
+		var search interface{}
+		if err := json.Unmarshal(request.Params.Search, &search); err != nil {
+			return nil, err
+		}
+		// get steps have no inputs, so there's nowhere to read a query from
+		if _, ok := search.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("search must be a query")
+		}
+	}
+	if request.Params.SearchLimit < 0 {
+		return nil, fmt.Errorf("search_limit must not be negative")
+	}
+	if request.Params.Export != nil {
+		if !request.Source.TracksDocuments() {
+			return nil, fmt.Errorf("export is only supported for documents")
+		} else if len(request.Source.SortFields) == 0 {
+			return nil, fmt.Errorf("export requires sort_fields")
+		}
+		if request.Params.SkipDownload || request.Params.HasContext() || len(request.Params.Search) > 0 {
+			return nil, fmt.Errorf("export can't be combined with skip_download, before, after, window or search")
+		}
+		if err := request.Params.Export.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &request, nil
 }
 
 func NewOutRequest(reader io.Reader) (*OutRequest, error) {
@@ -59,8 +183,95 @@ func NewOutRequest(reader io.Reader) (*OutRequest, error) {
 		return nil, err
 	}
 
-	if request.Params.Document == "" {
-		return nil, fmt.Errorf("no document path provided")
+	if request.Params == nil {
+		return nil, fmt.Errorf("no params provided")
+	}
+	if es.IsRemote(request.Source.Index) {
+		return nil, fmt.Errorf("invalid source config: can't put to remote cluster index %s", request.Source.Index)
+	}
+
+	switch request.Params.Action {
+	case "", ActionIndex:
+		err = validateDocumentSource(request.Params)
+	case ActionDelete, ActionTombstone:
+		err = validateTarget(request.Params)
+		if err == nil && request.Params.Action == ActionTombstone && request.Source.TombstoneField == "" {
+			err = fmt.Errorf("invalid source config: tombstone_field required for %s", ActionTombstone)
+		}
+	case ActionSnapshot, ActionRestore:
+		err = validateSnapshot(&request.Source, request.Params)
+	case ActionReindex:
+		if request.Source.Index == "" || request.Params.Dest == "" {
+			err = fmt.Errorf("%s requires the source's index and a dest", request.Params.Action)
+		} else if request.Params.Dest == request.Source.Index {
+			err = fmt.Errorf("can't %s %s into itself", request.Params.Action, request.Params.Dest)
+		} else if request.Params.Timeout != "" {
+			if _, parseErr := time.ParseDuration(request.Params.Timeout); parseErr != nil {
+				err = fmt.Errorf("invalid timeout: %s", parseErr)
+			}
+		}
+	case ActionWaitForHealth:
+		if request.Params.Health != "" && !es.ValidHealth(request.Params.Health) {
+			err = fmt.Errorf("invalid health: %s", request.Params.Health)
+		} else if request.Params.Timeout != "" {
+			if _, parseErr := time.ParseDuration(request.Params.Timeout); parseErr != nil {
+				err = fmt.Errorf("invalid timeout: %s", parseErr)
+			}
+		}
+	case ActionAddAlias, ActionRemoveAlias, ActionSwapAlias, ActionRollover:
+		if request.Params.Alias == "" {
+			err = fmt.Errorf("%s requires an alias", request.Params.Action)
+		} else if len(request.Params.Indices) == 0 && request.Source.Index == "" && (request.Params.Action == ActionAddAlias || request.Params.Action == ActionSwapAlias) {
+			err = fmt.Errorf("%s requires indices or the source's index", request.Params.Action)
+		}
+	default:
+		err = fmt.Errorf("invalid action: %s", request.Params.Action)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch request.Params.Refresh {
+	case "", "false", "true", "wait_for":
+	default:
+		return nil, fmt.Errorf("invalid refresh: %s", request.Params.Refresh)
 	}
 	return &request, nil
 }
+
+func validateDocumentSource(params *OutParams) error {
+	sources := 0
+	for _, source := range []string{params.Document, params.Template, params.InlineTemplate} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources == 0 {
+		return fmt.Errorf("no document path or template provided")
+	} else if sources > 1 {
+		return fmt.Errorf("only one of document, template or inline_template may be provided")
+	}
+	return nil
+}
+
+func validateTarget(params *OutParams) error {
+	if params.Id == "" && params.Query == nil {
+		return fmt.Errorf("%s requires an id or query", params.Action)
+	} else if params.Id != "" && params.Query != nil {
+		return fmt.Errorf("only one of id or query may be provided")
+	}
+	return nil
+}
+
+func validateSnapshot(source *SourceConfig, params *OutParams) error {
+	if source.SnapshotRepository == "" {
+		return fmt.Errorf("invalid source config: snapshot_repository required for %s", params.Action)
+	} else if params.Action == ActionRestore && params.Snapshot == "" {
+		return fmt.Errorf("%s requires a snapshot", params.Action)
+	} else if params.RenamePattern != "" && params.Action != ActionRestore {
+		return fmt.Errorf("rename_pattern only applies to %s", ActionRestore)
+	} else if params.RenameReplacement != "" && params.RenamePattern == "" {
+		return fmt.Errorf("rename_replacement requires rename_pattern")
+	}
+	return nil
+}
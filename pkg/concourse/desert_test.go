@@ -44,6 +44,11 @@ func TestNewCheckRequest(t *testing.T) {
 			t.Error("Should be missing fields")
 			return
 		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"updated_at_field":"updated"}}`))
+		if err == nil {
+			t.Error("updated_at_field should require track_updates")
+			return
+		}
 	})
 
 	t.Run("Passing", func(t *testing.T) {
@@ -53,6 +58,115 @@ func TestNewCheckRequest(t *testing.T) {
 			return
 		}
 	})
+
+	t.Run("Aggregation", func(t *testing.T) {
+		_, err := NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"aggregation":{"type":"terms","field":"release","max_field":"timestamp"}}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"aggregation":{"type":"terms","field":"release"}}}`))
+		if err == nil {
+			t.Error("terms should require a max field")
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"aggregation":{"type":"date_histogram","field":"timestamp"}}}`))
+		if err == nil {
+			t.Error("date_histogram should require an interval")
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"aggregation":{"type":"avg","field":"timestamp"}}}`))
+		if err == nil {
+			t.Error("Should be an invalid aggregation type")
+			return
+		}
+	})
+
+	t.Run("First check", func(t *testing.T) {
+		_, err := NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"lookback":"24h","emit_all_on_first_check":true}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"initial_version":{"cursor":{"field":"2020-05-10T00:00:00Z"}}}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"max_versions_per_check":-1}}`))
+		if err == nil {
+			t.Error("Should be an invalid max_versions_per_check")
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"collapse":"id","dedupe_field":"id"}}`))
+		if err == nil {
+			t.Error("collapse and dedupe_field should be mutually exclusive")
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"lookback":"yesterday"}}`))
+		if err == nil {
+			t.Error("Should be an invalid lookback")
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"initial_version":{}}}`))
+		if err == nil {
+			t.Error("initial_version should require an id or cursor")
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"initial_version":{"id":"abc"},"lookback":"24h"}}`))
+		if err == nil {
+			t.Error("initial_version and lookback should be mutually exclusive")
+			return
+		}
+	})
+
+	t.Run("Threshold", func(t *testing.T) {
+		_, err := NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"threshold":{"time_field":"timestamp","window":"15m","operator":"gt","value":100}}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"threshold":{"time_field":"timestamp","window":"15m","operator":"gt","value":100},"aggregation":{"type":"terms","field":"release","max_field":"timestamp"}}}`))
+		if err == nil {
+			t.Error("Threshold and aggregation should be mutually exclusive")
+			return
+		}
+	})
+	t.Run("Track snapshots", func(t *testing.T) {
+		_, err := NewCheckRequest(strings.NewReader(`{"source":{"addresses":["local"],"track":"snapshots","snapshot_repository":"backups"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"addresses":["local"],"track":"snapshots"}}`))
+		if err == nil {
+			t.Error("Tracking snapshots should require a snapshot_repository")
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"track":"everything"}}`))
+		if err == nil {
+			t.Error("Should be an invalid track")
+			return
+		}
+	})
+
+	t.Run("Track indices", func(t *testing.T) {
+		_, err := NewCheckRequest(strings.NewReader(`{"source":{"index": "etl-*","addresses":["local"],"track":"indices","health":"green"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "etl-*","addresses":["local"],"track":"indices","health":"blue"}}`))
+		if err == nil {
+			t.Error("Should be an invalid health")
+			return
+		}
+		_, err = NewCheckRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"health":"green"}}`))
+		if err == nil {
+			t.Error("Health should only apply to tracking indices")
+			return
+		}
+	})
 }
 
 func TestNewInRequest(t *testing.T) {
@@ -60,6 +174,106 @@ func TestNewInRequest(t *testing.T) {
 		_, err := NewInRequest(r)
 		return err
 	})
+
+	t.Run("Context", func(t *testing.T) {
+		source := `"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]}`
+		request, err := NewInRequest(strings.NewReader(`{` + source + `,"params":{"before":2,"after":3}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !request.Params.HasContext() {
+			t.Error("Should fetch context")
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"before":-1}}`))
+		if err == nil {
+			t.Error("Before should not be negative")
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"window":"15m","after":1}}`))
+		if err == nil {
+			t.Error("Window and after should be mutually exclusive")
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"window":"soon"}}`))
+		if err == nil {
+			t.Error("Window should be a duration")
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"window":"15m","window_limit":100}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"before":1,"window_limit":100}}`))
+		if err == nil {
+			t.Error("Window limit should require a window")
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"window":"15m","window_limit":-1}}`))
+		if err == nil {
+			t.Error("Window limit should not be negative")
+			return
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		source := `"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]}`
+		_, err := NewInRequest(strings.NewReader(`{` + source + `,"params":{"missing":"ignore","skip_download":true}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"missing":"shrug"}}`))
+		if err == nil {
+			t.Error("Should be an invalid missing")
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"skip_download":true,"after":1}}`))
+		if err == nil {
+			t.Error("skip_download should exclude context")
+			return
+		}
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		source := `"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]}`
+		_, err := NewInRequest(strings.NewReader(`{` + source + `,"params":{"export":{"format":"csv","columns":["a.b"]}}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"export":{},"skip_download":true}}`))
+		if err == nil {
+			t.Error("Export should exclude skip_download")
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"aggregation":{"type":"terms","field":"f","max_field":"timestamp"}},"params":{"export":{}}}`))
+		if err == nil {
+			t.Error("Export should require documents")
+			return
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		source := `"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]}`
+		_, err := NewInRequest(strings.NewReader(`{` + source + `,"params":{"search":{"match_all":{}}}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"search":"query.json"}}`))
+		if err == nil {
+			t.Error("Search shouldn't be read from a path")
+			return
+		}
+		_, err = NewInRequest(strings.NewReader(`{` + source + `,"params":{"search":[]}}`))
+		if err == nil {
+			t.Error("Search should be a query")
+			return
+		}
+	})
 }
 
 func TestNewOutRequest(t *testing.T) {
@@ -67,4 +281,196 @@ func TestNewOutRequest(t *testing.T) {
 		_, err := NewOutRequest(r)
 		return err
 	})
+
+	t.Run("Document source", func(t *testing.T) {
+		_, err := NewOutRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]},"params":{"inline_template":"{}"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]},"params":{}}`))
+		if err == nil {
+			t.Error("Should be missing a document source")
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]},"params":{"document":"doc.json","template":"doc.tmpl"}}`))
+		if err == nil {
+			t.Error("Should only allow one document source")
+			return
+		}
+	})
+
+	t.Run("Pipeline and routing", func(t *testing.T) {
+		request, err := NewOutRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"routing":"tenant-a"},"params":{"inline_template":"{}","pipeline":"enrich","routing":"tenant-b"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if request.Source.Routing != "tenant-a" || request.Params.Routing != "tenant-b" || request.Params.Pipeline != "enrich" {
+			t.Errorf("Unexpected routing or pipeline: %+v, %+v", request.Source, request.Params)
+			return
+		}
+		inRequest, err := NewInRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]},"version":{"id":"abc","routing":"tenant-b"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if inRequest.Version.Routing != "tenant-b" {
+			t.Errorf("Expected the version's routing; got %q", inRequest.Version.Routing)
+			return
+		}
+	})
+
+	t.Run("Actions", func(t *testing.T) {
+		source := `"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]}`
+		_, err := NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"delete","id":"abc"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"delete","query":{"term":{"field":"x"}}}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"delete"}}`))
+		if err == nil {
+			t.Error("Delete should require an id or query")
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"tombstone","id":"abc"}}`))
+		if err == nil {
+			t.Error("Tombstone should require a tombstone_field")
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"],"tombstone_field":"retracted"},"params":{"action":"tombstone","id":"abc"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"explode","id":"abc"}}`))
+		if err == nil {
+			t.Error("Should be an invalid action")
+			return
+		}
+	})
+
+	t.Run("Snapshots", func(t *testing.T) {
+		source := `"source":{"addresses":["local"],"track":"snapshots","snapshot_repository":"backups"}`
+		_, err := NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"snapshot","indices":["events"]}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"restore","snapshot":"nightly","rename_pattern":"(.+)","rename_replacement":"restored-$1"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"restore"}}`))
+		if err == nil {
+			t.Error("Restore should require a snapshot")
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"snapshot","rename_pattern":"(.+)"}}`))
+		if err == nil {
+			t.Error("rename_pattern should only apply to restore")
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]},"params":{"action":"snapshot"}}`))
+		if err == nil {
+			t.Error("Snapshot should require a snapshot_repository")
+			return
+		}
+	})
+
+	t.Run("Reindex", func(t *testing.T) {
+		source := `"source":{"index": "events-v1","addresses":["local"],"sort_fields":["timestamp"]}`
+		_, err := NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"reindex","dest":"events-v2","dest_sort_fields":["timestamp","id"],"alias":"events"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"reindex"}}`))
+		if err == nil {
+			t.Error("Reindex should require a dest")
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"reindex","dest":"events-v1"}}`))
+		if err == nil {
+			t.Error("Reindex should not target the source index")
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"reindex","dest":"events-v2","timeout":"2h"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"reindex","dest":"events-v2","timeout":"soon"}}`))
+		if err == nil {
+			t.Error("Reindex should require a valid timeout")
+			return
+		}
+	})
+
+	t.Run("Aliases", func(t *testing.T) {
+		source := `"source":{"index": "events-v2","addresses":["local"],"sort_fields":["timestamp"]}`
+		_, err := NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"swap_alias","alias":"events"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"rollover","alias":"events-write","conditions":{"max_age":"7d","max_docs":1000000}}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"add_alias","indices":["events-v1"]}}`))
+		if err == nil {
+			t.Error("Alias actions should require an alias")
+			return
+		}
+	})
+
+	t.Run("Wait for health", func(t *testing.T) {
+		source := `"source":{"addresses":["local"],"track":"health"}`
+		_, err := NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"wait_for_health","health":"yellow","timeout":"10m"}}`))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"wait_for_health","health":"purple"}}`))
+		if err == nil {
+			t.Error("Should be an invalid health")
+			return
+		}
+		_, err = NewOutRequest(strings.NewReader(`{` + source + `,"params":{"action":"wait_for_health","timeout":"eventually"}}`))
+		if err == nil {
+			t.Error("Should be an invalid timeout")
+			return
+		}
+	})
+
+	t.Run("Remote index", func(t *testing.T) {
+		_, err := NewOutRequest(strings.NewReader(`{"source":{"index": "remote:events","addresses":["local"],"sort_fields":["field"]},"params":{"document":"doc.json"}}`))
+		if err == nil {
+			t.Error("Should not put to a remote index")
+			return
+		}
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		for _, refresh := range []string{"", "false", "true", "wait_for"} {
+			_, err := NewOutRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]},"params":{"document":"doc.json","refresh":"` + refresh + `"}}`))
+			if err != nil {
+				t.Errorf("refresh %s should be valid: %s", refresh, err)
+				return
+			}
+		}
+		_, err := NewOutRequest(strings.NewReader(`{"source":{"index": "myidx","addresses":["local"],"sort_fields":["field"]},"params":{"document":"doc.json","refresh":"sometimes"}}`))
+		if err == nil {
+			t.Error("Should be an invalid refresh")
+			return
+		}
+	})
 }
@@ -0,0 +1,177 @@
+package concourse
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
+	"io"
+)
+
+// Formats the in export can write.
+const (
+	ExportCsv     = "csv"
+	ExportNdjson  = "ndjson"
+	ExportParquet = "parquet"
+)
+
+// ExportParams configures exporting every document matched by the source.
+type ExportParams struct {
+	Format  string   `json:"format,omitempty"`
+	Columns []string `json:"columns,omitempty"`
+	File    string   `json:"file,omitempty"`
+	Limit   int      `json:"limit,omitempty"`
+}
+
+func (e *ExportParams) validate() error {
+	switch e.Format {
+	case ExportCsv, ExportParquet:
+		if len(e.Columns) == 0 {
+			return fmt.Errorf("columns required for %s export", e.Format)
+		}
+	case "", ExportNdjson:
+	default:
+		return fmt.Errorf("unsupported export format: %s", e.Format)
+	}
+	if e.Limit < 0 {
+		return fmt.Errorf("export limit must not be negative")
+	}
+	return nil
+}
+
+// FileName is the export's file, defaulting to export.<format>.
+func (e *ExportParams) FileName() string {
+	if e.File != "" {
+		return e.File
+	}
+	if e.Format == "" {
+		return "export." + ExportNdjson
+	}
+	return "export." + e.Format
+}
+
+// ExportWriter writes hits in an export's format as they're read, finishing the file on Close.
+type ExportWriter interface {
+	Write(hits []es.Hit) error
+	Close() error
+}
+
+// NewExportWriter writes to the writer in the export's format.
+func NewExportWriter(writer io.Writer, params *ExportParams) ExportWriter {
+	switch params.Format {
+	case ExportCsv:
+		return &csvWriter{writer: csv.NewWriter(writer), columns: params.Columns}
+	case ExportParquet:
+		return &parquetWriter{writer: writer, columns: params.Columns}
+	}
+	return &ndjsonWriter{writer: writer}
+}
+
+// WriteExport writes the hits' sources in the export's format.
+func WriteExport(writer io.Writer, hits []es.Hit, params *ExportParams) error {
+	export := NewExportWriter(writer, params)
+	if err := export.Write(hits); err != nil {
+		return err
+	}
+	return export.Close()
+}
+
+// WriteNdjson writes each hit's source on its own line.
+func WriteNdjson(writer io.Writer, hits []es.Hit) error {
+	return (&ndjsonWriter{writer: writer}).Write(hits)
+}
+
+type ndjsonWriter struct {
+	writer io.Writer
+	buf    bytes.Buffer
+}
+
+func (w *ndjsonWriter) Write(hits []es.Hit) error {
+	for _, hit := range hits {
+		w.buf.Reset()
+		// sources are returned as indexed, which may span lines
+		if err := json.Compact(&w.buf, hit.Source); err != nil {
+			return err
+		}
+		w.buf.WriteByte('\n')
+		if _, err := w.writer.Write(w.buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
+
+// csvWriter writes a header of the columns, which may be dotted paths, followed by a row per hit.
+// Missing fields are left empty and objects and arrays are written as JSON.
+type csvWriter struct {
+	writer  *csv.Writer
+	columns []string
+	header  bool
+}
+
+func (w *csvWriter) Write(hits []es.Hit) error {
+	if !w.header {
+		if err := w.writer.Write(w.columns); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	row := make([]string, len(w.columns))
+	for _, hit := range hits {
+		source, err := decodeSource(hit)
+		if err != nil {
+			return err
+		}
+		for i, column := range w.columns {
+			value, _ := es.FieldValue(source, column)
+			cell, err := csvCell(value)
+			if err != nil {
+				return err
+			}
+			row[i] = cell
+		}
+		if err := w.writer.Write(row); err != nil {
+			return err
+		}
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvWriter) Close() error {
+	// an empty export still has its header
+	return w.Write(nil)
+}
+
+func decodeSource(hit es.Hit) (map[string]interface{}, error) {
+	var source map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(hit.Source))
+	// keeps numbers out of exponent notation
+	decoder.UseNumber()
+	if err := decoder.Decode(&source); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+func csvCell(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	default:
+		marshal, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(marshal), nil
+	}
+}
@@ -0,0 +1,62 @@
+package concourse
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
+	"testing"
+)
+
+func TestWriteExport(t *testing.T) {
+	hits := []es.Hit{
+		{ID: "1", Source: json.RawMessage(`{"service":{"name":"api"},"latency":1234567890,"tags":["a","b"]}`)},
+		{ID: "2", Source: json.RawMessage("{\n  \"service\": {\"name\": \"web, frontend\"}\n}")},
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := WriteExport(&buf, hits, &ExportParams{Format: ExportCsv, Columns: []string{"service.name", "latency", "tags"}})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expected := "service.name,latency,tags\napi,1234567890,\"[\"\"a\"\",\"\"b\"\"]\"\n\"web, frontend\",,\n"
+		if buf.String() != expected {
+			t.Errorf("Expected %q; got %q", expected, buf.String())
+			return
+		}
+	})
+
+	t.Run("NDJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := WriteExport(&buf, hits, &ExportParams{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expected := `{"service":{"name":"api"},"latency":1234567890,"tags":["a","b"]}` + "\n" + `{"service":{"name":"web, frontend"}}` + "\n"
+		if buf.String() != expected {
+			t.Errorf("Expected %q; got %q", expected, buf.String())
+			return
+		}
+	})
+}
+
+func TestExportParamsValidate(t *testing.T) {
+	if err := (&ExportParams{Format: ExportCsv}).validate(); err == nil {
+		t.Error("CSV should require columns")
+		return
+	}
+	if err := (&ExportParams{Format: ExportParquet}).validate(); err == nil {
+		t.Error("Parquet should require columns")
+		return
+	}
+	if err := (&ExportParams{Format: "xlsx"}).validate(); err == nil {
+		t.Error("XLSX should be unsupported")
+		return
+	}
+	if name := (&ExportParams{Format: ExportCsv}).FileName(); name != "export.csv" {
+		t.Errorf("Unexpected file name: %s", name)
+		return
+	}
+}
@@ -1,9 +1,47 @@
 package concourse
 
-func MapVersion(vs []string, f func(string) Version) []Version {
-	vsm := make([]Version, len(vs))
-	for i, v := range vs {
-		vsm[i] = f(v)
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
+	"strconv"
+	"time"
+)
+
+func MapVersion(hits []es.Hit, f func(es.Hit) Version) []Version {
+	vsm := make([]Version, len(hits))
+	for i, hit := range hits {
+		vsm[i] = f(hit)
 	}
 	return vsm
 }
+
+// DocumentId derives a document's ID from the values of its sort fields, which must all be strings.
+func DocumentId(document map[string]interface{}, sortFields []string) (string, error) {
+	digest := sha256.New()
+	for _, field := range sortFields {
+		if _, ok := document[field]; !ok {
+			return "", fmt.Errorf("sort field, %s, missing from document", field)
+		}
+		value, ok := document[field].(string)
+		if !ok {
+			return "", fmt.Errorf("%s must be a string", field)
+		}
+		_, err := digest.Write([]byte(value))
+		if err != nil {
+			return "", fmt.Errorf("error adding to digest: %s", err)
+		}
+	}
+	return base64.URLEncoding.EncodeToString(digest.Sum(nil)), nil
+}
+
+// HealthVersion records the health as observed at the time, naming the version for its status.
+func HealthVersion(health *es.ClusterHealth, observedAt time.Time) Version {
+	return Version{
+		Id:               health.Status,
+		ObservedAt:       observedAt.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		ActiveShards:     strconv.Itoa(health.ActiveShards),
+		UnassignedShards: strconv.Itoa(health.UnassignedShards),
+	}
+}
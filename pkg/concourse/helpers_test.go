@@ -0,0 +1,55 @@
+package concourse
+
+import (
+	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
+	"testing"
+	"time"
+)
+
+func TestDocumentId(t *testing.T) {
+	sortFields := []string{"timestamp", "name"}
+
+	t.Run("Sort fields", func(t *testing.T) {
+		id, err := DocumentId(map[string]interface{}{"timestamp": "2020-05-10T00:00:00Z", "name": "a", "other": 1.0}, sortFields)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		same, err := DocumentId(map[string]interface{}{"timestamp": "2020-05-10T00:00:00Z", "name": "a"}, sortFields)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if id == "" || id != same {
+			t.Errorf("IDs should only depend on the sort fields: %s != %s", id, same)
+			return
+		}
+	})
+
+	t.Run("Missing sort field", func(t *testing.T) {
+		_, err := DocumentId(map[string]interface{}{"timestamp": "2020-05-10T00:00:00Z"}, sortFields)
+		if err == nil {
+			t.Error("Should be missing the name")
+			return
+		}
+	})
+
+	t.Run("Non-string sort field", func(t *testing.T) {
+		_, err := DocumentId(map[string]interface{}{"timestamp": "2020-05-10T00:00:00Z", "name": 1.0}, sortFields)
+		if err == nil {
+			t.Error("Name should have to be a string")
+			return
+		}
+	})
+}
+
+func TestHealthVersion(t *testing.T) {
+	health := &es.ClusterHealth{Status: es.HealthYellow, ActiveShards: 4, UnassignedShards: 1}
+	observedAt := time.Date(2020, 5, 10, 1, 2, 3, 0, time.FixedZone("", 3600))
+	version := HealthVersion(health, observedAt)
+	expected := Version{Id: "yellow", ObservedAt: "2020-05-10T00:02:03.000Z", ActiveShards: "4", UnassignedShards: "1"}
+	if version != expected {
+		t.Errorf("Unexpected version: %+v", version)
+		return
+	}
+}
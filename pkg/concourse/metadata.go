@@ -0,0 +1,63 @@
+package concourse
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const DefaultEnrichKey = "concourse"
+
+// BuildMetadata is the build environment concourse exposes to put steps.
+// See: https://concourse-ci.org/implementing-resource-types.html#resource-metadata
+type BuildMetadata struct {
+	BuildId      string
+	BuildName    string
+	JobName      string
+	PipelineName string
+	TeamName     string
+	ExternalUrl  string
+}
+
+func NewBuildMetadata() BuildMetadata {
+	return BuildMetadata{
+		BuildId:      os.Getenv("BUILD_ID"),
+		BuildName:    os.Getenv("BUILD_NAME"),
+		JobName:      os.Getenv("BUILD_JOB_NAME"),
+		PipelineName: os.Getenv("BUILD_PIPELINE_NAME"),
+		TeamName:     os.Getenv("BUILD_TEAM_NAME"),
+		ExternalUrl:  os.Getenv("ATC_EXTERNAL_URL"),
+	}
+}
+
+// BuildUrl is the link to the build in the concourse UI; empty for one-off builds.
+func (m BuildMetadata) BuildUrl() string {
+	if m.ExternalUrl == "" || m.PipelineName == "" || m.JobName == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/teams/%s/pipelines/%s/jobs/%s/builds/%s", m.ExternalUrl, m.TeamName, m.PipelineName, m.JobName, m.BuildName)
+}
+
+// Enrich adds the build metadata and an ingest timestamp to the document under the given key.
+func Enrich(document map[string]interface{}, key string, metadata BuildMetadata, now time.Time) {
+	if key == "" {
+		key = DefaultEnrichKey
+	}
+	enrichment := map[string]interface{}{
+		"ingested_at": now.UTC().Format(time.RFC3339Nano),
+	}
+	for field, value := range map[string]string{
+		"build_id":      metadata.BuildId,
+		"build_name":    metadata.BuildName,
+		"job_name":      metadata.JobName,
+		"pipeline_name": metadata.PipelineName,
+		"team_name":     metadata.TeamName,
+		"external_url":  metadata.ExternalUrl,
+		"build_url":     metadata.BuildUrl(),
+	} {
+		if value != "" {
+			enrichment[field] = value
+		}
+	}
+	document[key] = enrichment
+}
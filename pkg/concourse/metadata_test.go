@@ -0,0 +1,54 @@
+package concourse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnrich(t *testing.T) {
+	metadata := BuildMetadata{
+		BuildId:      "42",
+		BuildName:    "7",
+		JobName:      "deploy",
+		PipelineName: "events",
+		TeamName:     "main",
+		ExternalUrl:  "https://ci.example.com",
+	}
+	now := time.Date(2020, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Default key", func(t *testing.T) {
+		doc := map[string]interface{}{"message": "hi"}
+		Enrich(doc, "", metadata, now)
+		enrichment, ok := doc[DefaultEnrichKey].(map[string]interface{})
+		if !ok {
+			t.Errorf("Expected enrichment under %s", DefaultEnrichKey)
+			return
+		}
+		if enrichment["ingested_at"] != "2020-05-10T00:00:00Z" {
+			t.Errorf("Unexpected ingest timestamp: %v", enrichment["ingested_at"])
+			return
+		}
+		if enrichment["build_url"] != "https://ci.example.com/teams/main/pipelines/events/jobs/deploy/builds/7" {
+			t.Errorf("Unexpected build url: %v", enrichment["build_url"])
+			return
+		}
+		if doc["message"] != "hi" {
+			t.Error("Existing fields should be untouched")
+			return
+		}
+	})
+
+	t.Run("One-off build", func(t *testing.T) {
+		doc := map[string]interface{}{}
+		Enrich(doc, "ci", BuildMetadata{BuildId: "1"}, now)
+		enrichment := doc["ci"].(map[string]interface{})
+		if _, ok := enrichment["build_url"]; ok {
+			t.Error("One-off builds have no build url")
+			return
+		}
+		if _, ok := enrichment["job_name"]; ok {
+			t.Error("Empty fields should be omitted")
+			return
+		}
+	})
+}
@@ -0,0 +1,290 @@
+package concourse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
+	"io"
+)
+
+// Parquet's file layout and the subset of its Thrift definitions the export needs.
+// See https://github.com/apache/parquet-format for the full specification.
+const (
+	parquetMagic = "PAR1"
+
+	// Type
+	parquetByteArray = 6
+	// FieldRepetitionType
+	parquetOptional = 1
+	// ConvertedType
+	parquetUtf8 = 0
+	// Encoding
+	parquetPlain = 0
+	parquetRle   = 3
+	// PageType
+	parquetDataPage = 0
+)
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// parquetWriter writes the columns, which may be dotted paths, as a Parquet file of optional string columns with a
+// row group per write. Missing fields are null and objects and arrays are written as JSON, as for CSV.
+// Pages are written uncompressed and PLAIN encoded so the file is readable by any Parquet implementation.
+type parquetWriter struct {
+	writer  io.Writer
+	columns []string
+	// bytes written so far, locating each page in the file
+	offset int64
+	rows   int64
+	// the row groups' metadata, written in the footer once every row group is
+	rowGroups      bytes.Buffer
+	rowGroupsCount int
+}
+
+func (w *parquetWriter) write(data []byte) error {
+	n, err := w.writer.Write(data)
+	w.offset += int64(n)
+	return err
+}
+
+func (w *parquetWriter) begin() error {
+	if w.offset > 0 {
+		return nil
+	}
+	return w.write([]byte(parquetMagic))
+}
+
+func (w *parquetWriter) Write(hits []es.Hit) error {
+	if len(hits) == 0 {
+		return nil
+	}
+	if err := w.begin(); err != nil {
+		return err
+	}
+
+	// each column's values, nil where the field is missing
+	values := make([][]*string, len(w.columns))
+	for _, hit := range hits {
+		source, err := decodeSource(hit)
+		if err != nil {
+			return err
+		}
+		for i, column := range w.columns {
+			value, ok := es.FieldValue(source, column)
+			if !ok || value == nil {
+				values[i] = append(values[i], nil)
+				continue
+			}
+			cell, err := csvCell(value)
+			if err != nil {
+				return err
+			}
+			values[i] = append(values[i], &cell)
+		}
+	}
+
+	rowGroup := &thriftWriter{}
+	rowGroup.listHeader(1, thriftStruct, len(w.columns))
+	var totalSize int64
+	for i, column := range w.columns {
+		offset := w.offset
+		page := parquetPage(values[i])
+		if err := w.write(page); err != nil {
+			return err
+		}
+		totalSize += int64(len(page))
+
+		rowGroup.beginElement()
+		rowGroup.i64(2, offset)
+		rowGroup.beginStruct(3)
+		rowGroup.i32(1, parquetByteArray)
+		rowGroup.listHeader(2, thriftI32, 2)
+		rowGroup.varint(zigzag(parquetPlain))
+		rowGroup.varint(zigzag(parquetRle))
+		rowGroup.listHeader(3, thriftBinary, 1)
+		rowGroup.bytes([]byte(column))
+		// uncompressed
+		rowGroup.i32(4, 0)
+		rowGroup.i64(5, int64(len(values[i])))
+		rowGroup.i64(6, int64(len(page)))
+		rowGroup.i64(7, int64(len(page)))
+		rowGroup.i64(9, offset)
+		rowGroup.endStruct()
+		rowGroup.endStruct()
+	}
+	rowGroup.i64(2, totalSize)
+	rowGroup.i64(3, int64(len(hits)))
+	rowGroup.endStruct()
+
+	w.rowGroups.Write(rowGroup.buf.Bytes())
+	w.rowGroupsCount++
+	w.rows += int64(len(hits))
+	return nil
+}
+
+// Close writes the footer: the file's schema and where each row group's pages are.
+func (w *parquetWriter) Close() error {
+	if err := w.begin(); err != nil {
+		return err
+	}
+
+	footer := &thriftWriter{}
+	footer.i32(1, 1)
+	footer.listHeader(2, thriftStruct, len(w.columns)+1)
+	footer.beginElement()
+	footer.binary(4, "schema")
+	footer.i32(5, int32(len(w.columns)))
+	footer.endStruct()
+	for _, column := range w.columns {
+		footer.beginElement()
+		footer.i32(1, parquetByteArray)
+		footer.i32(3, parquetOptional)
+		footer.binary(4, column)
+		footer.i32(6, parquetUtf8)
+		footer.endStruct()
+	}
+	footer.i64(3, w.rows)
+	footer.listHeader(4, thriftStruct, w.rowGroupsCount)
+	footer.buf.Write(w.rowGroups.Bytes())
+	footer.binary(6, "concourse-elasticsearch")
+	footer.endStruct()
+
+	size := footer.buf.Len()
+	if err := binary.Write(&footer.buf, binary.LittleEndian, uint32(size)); err != nil {
+		return err
+	}
+	footer.buf.WriteString(parquetMagic)
+	return w.write(footer.buf.Bytes())
+}
+
+// parquetPage is a data page, with its header, of the column's values.
+func parquetPage(values []*string) []byte {
+	var levels bytes.Buffer
+	// definition levels, 1 where the value is present, as runs of the RLE hybrid encoding with a bit width of 1
+	for start := 0; start < len(values); {
+		defined := values[start] != nil
+		end := start
+		for end < len(values) && (values[end] != nil) == defined {
+			end++
+		}
+		writeUvarint(&levels, uint64(end-start)<<1)
+		if defined {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		start = end
+	}
+
+	var data bytes.Buffer
+	_ = binary.Write(&data, binary.LittleEndian, uint32(levels.Len()))
+	data.Write(levels.Bytes())
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		_ = binary.Write(&data, binary.LittleEndian, uint32(len(*value)))
+		data.WriteString(*value)
+	}
+
+	header := &thriftWriter{}
+	header.i32(1, parquetDataPage)
+	header.i32(2, int32(data.Len()))
+	header.i32(3, int32(data.Len()))
+	header.beginStruct(5)
+	header.i32(1, int32(len(values)))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRle)
+	header.i32(4, parquetRle)
+	header.endStruct()
+	header.endStruct()
+	return append(header.buf.Bytes(), data.Bytes()...)
+}
+
+// thriftWriter encodes structs with Thrift's compact protocol, the encoding of Parquet's metadata.
+// The top-level struct is implicit; each struct, including list elements, is closed with endStruct.
+type thriftWriter struct {
+	buf bytes.Buffer
+	// the last field ID written in each enclosing struct, as field IDs are encoded as deltas
+	fields []int16
+	last   int16
+}
+
+func (w *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	if delta := id - w.last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		w.buf.WriteByte(fieldType)
+		w.varint(zigzag(int64(id)))
+	}
+	w.last = id
+}
+
+func (w *thriftWriter) i32(id int16, value int32) {
+	w.fieldHeader(id, thriftI32)
+	w.varint(zigzag(int64(value)))
+}
+
+func (w *thriftWriter) i64(id int16, value int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(zigzag(value))
+}
+
+func (w *thriftWriter) binary(id int16, value string) {
+	w.fieldHeader(id, thriftBinary)
+	w.bytes([]byte(value))
+}
+
+func (w *thriftWriter) bytes(value []byte) {
+	w.varint(uint64(len(value)))
+	w.buf.Write(value)
+}
+
+func (w *thriftWriter) listHeader(id int16, elementType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		w.buf.WriteByte(0xf0 | elementType)
+		w.varint(uint64(size))
+	}
+}
+
+// beginStruct starts a struct field; beginElement starts a struct within a list.
+func (w *thriftWriter) beginStruct(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.beginElement()
+}
+
+func (w *thriftWriter) beginElement() {
+	w.fields = append(w.fields, w.last)
+	w.last = 0
+}
+
+func (w *thriftWriter) endStruct() {
+	w.buf.WriteByte(0)
+	if len(w.fields) > 0 {
+		w.last = w.fields[len(w.fields)-1]
+		w.fields = w.fields[:len(w.fields)-1]
+	}
+}
+
+func (w *thriftWriter) varint(value uint64) {
+	writeUvarint(&w.buf, value)
+}
+
+func writeUvarint(buf *bytes.Buffer, value uint64) {
+	var encoded [binary.MaxVarintLen64]byte
+	buf.Write(encoded[:binary.PutUvarint(encoded[:], value)])
+}
+
+func zigzag(value int64) uint64 {
+	return uint64((value << 1) ^ (value >> 63))
+}
@@ -0,0 +1,238 @@
+package concourse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
+	"reflect"
+	"testing"
+)
+
+func TestParquetWriter(t *testing.T) {
+	pages := [][]es.Hit{
+		{
+			{ID: "1", Source: json.RawMessage(`{"service":{"name":"api"},"latency":1234567890}`)},
+			{ID: "2", Source: json.RawMessage(`{"latency":5,"tags":["a"]}`)},
+		},
+		{
+			{ID: "3", Source: json.RawMessage(`{"service":{"name":"web, frontend"}}`)},
+		},
+	}
+	columns := []string{"service.name", "latency"}
+	// each row group's values by column, nil where null
+	expected := [][][]interface{}{
+		{{"api", nil}, {"1234567890", "5"}},
+		{{"web, frontend"}, {nil}},
+	}
+
+	var buf bytes.Buffer
+	writer := NewExportWriter(&buf, &ExportParams{Format: ExportParquet, Columns: columns})
+	for _, page := range pages {
+		if err := writer.Write(page); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	file := buf.Bytes()
+	if !bytes.HasPrefix(file, []byte(parquetMagic)) || !bytes.HasSuffix(file, []byte(parquetMagic)) {
+		t.Error("Expected the Parquet magic number at either end")
+		return
+	}
+	length := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	if length <= 0 || length > len(file)-12 {
+		t.Errorf("Invalid footer length %d", length)
+		return
+	}
+	metadata := (&thriftReader{buf: file[len(file)-8-length : len(file)-8]}).structure()
+
+	if metadata[1] != int64(1) || metadata[3] != int64(3) {
+		t.Errorf("Expected version 1 with 3 rows; got %v", metadata)
+		return
+	}
+	schema := metadata[2].([]interface{})
+	if len(schema) != 3 || schema[0].(map[int16]interface{})[5] != int64(2) {
+		t.Errorf("Expected a root with 2 columns; got %v", schema)
+		return
+	}
+	for i, column := range columns {
+		element := schema[i+1].(map[int16]interface{})
+		// optional UTF8 byte arrays
+		if element[4] != column || element[1] != int64(parquetByteArray) || element[3] != int64(parquetOptional) || element[6] != int64(parquetUtf8) {
+			t.Errorf("Expected optional string column %s; got %v", column, element)
+			return
+		}
+	}
+
+	rowGroups := metadata[4].([]interface{})
+	if len(rowGroups) != len(pages) {
+		t.Errorf("Expected a row group per page; got %d", len(rowGroups))
+		return
+	}
+	for i, rowGroup := range rowGroups {
+		rowGroup := rowGroup.(map[int16]interface{})
+		if rowGroup[3] != int64(len(pages[i])) {
+			t.Errorf("Expected %d rows in row group %d; got %v", len(pages[i]), i, rowGroup[3])
+			return
+		}
+		chunks := rowGroup[1].([]interface{})
+		if len(chunks) != len(columns) {
+			t.Errorf("Expected a column chunk per column; got %d", len(chunks))
+			return
+		}
+		for j, chunk := range chunks {
+			meta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			if path := meta[3].([]interface{}); len(path) != 1 || path[0] != columns[j] {
+				t.Errorf("Expected the path %s; got %v", columns[j], path)
+				return
+			}
+			if meta[5] != int64(len(pages[i])) {
+				t.Errorf("Expected %d values; got %v", len(pages[i]), meta[5])
+				return
+			}
+
+			offset := int(meta[9].(int64))
+			page := &thriftReader{buf: file, pos: offset}
+			header := page.structure()
+			size := int(header[3].(int64))
+			if header[1] != int64(parquetDataPage) || meta[7] != int64(page.pos-offset+size) {
+				t.Errorf("Expected a data page of %v bytes; got %v", meta[7], header)
+				return
+			}
+			dataPage := header[5].(map[int16]interface{})
+			if dataPage[1] != int64(len(pages[i])) || dataPage[2] != int64(parquetPlain) || dataPage[3] != int64(parquetRle) {
+				t.Errorf("Expected PLAIN values with RLE definition levels; got %v", dataPage)
+				return
+			}
+
+			values := parquetValues(t, file[page.pos:page.pos+size], len(pages[i]))
+			if !reflect.DeepEqual(values, expected[i][j]) {
+				t.Errorf("Expected %v in row group %d's %s; got %v", expected[i][j], i, columns[j], values)
+				return
+			}
+		}
+	}
+}
+
+func TestParquetWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, nil, &ExportParams{Format: ExportParquet, Columns: []string{"id"}}); err != nil {
+		t.Error(err)
+		return
+	}
+	file := buf.Bytes()
+	length := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	metadata := (&thriftReader{buf: file[len(file)-8-length : len(file)-8]}).structure()
+	if metadata[3] != int64(0) || len(metadata[4].([]interface{})) != 0 {
+		t.Errorf("Expected no rows or row groups; got %v", metadata)
+		return
+	}
+}
+
+// parquetValues decodes a data page's RLE definition levels and PLAIN values, nil where the value is null.
+func parquetValues(t *testing.T, data []byte, count int) []interface{} {
+	levelsLength := int(binary.LittleEndian.Uint32(data))
+	levels := &thriftReader{buf: data[4 : 4+levelsLength]}
+	var defined []bool
+	for levels.pos < len(levels.buf) {
+		run := levels.uvarint()
+		if run&1 != 0 {
+			t.Fatalf("Unexpected bit-packed run")
+		}
+		value := levels.byte()
+		for k := uint64(0); k < run>>1; k++ {
+			defined = append(defined, value == 1)
+		}
+	}
+	if len(defined) != count {
+		t.Fatalf("Expected %d definition levels; got %d", count, len(defined))
+	}
+
+	pos := 4 + levelsLength
+	var values []interface{}
+	for _, isDefined := range defined {
+		if !isDefined {
+			values = append(values, nil)
+			continue
+		}
+		length := int(binary.LittleEndian.Uint32(data[pos:]))
+		values = append(values, string(data[pos+4:pos+4+length]))
+		pos += 4 + length
+	}
+	if pos != len(data) {
+		t.Fatalf("Expected the values to fill the page; %d bytes left", len(data)-pos)
+	}
+	return values
+}
+
+// thriftReader decodes Thrift compact structs as maps of field ID to value, the inverse of thriftWriter.
+// Integers are decoded as int64, binaries as strings and lists as slices.
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	value, n := binary.Uvarint(r.buf[r.pos:])
+	r.pos += n
+	return value
+}
+
+func (r *thriftReader) zigzag() int64 {
+	value := r.uvarint()
+	return int64(value>>1) ^ -int64(value&1)
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(header & 0x0f)
+		last = id
+	}
+}
+
+func (r *thriftReader) value(fieldType byte) interface{} {
+	switch fieldType {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		length := int(r.uvarint())
+		value := string(r.buf[r.pos : r.pos+length])
+		r.pos += length
+		return value
+	case thriftList:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := []interface{}{}
+		for i := 0; i < size; i++ {
+			list = append(list, r.value(header&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	panic("unsupported thrift type")
+}
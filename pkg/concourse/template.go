@@ -0,0 +1,88 @@
+package concourse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"text/template"
+)
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		marshal, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(marshal), nil
+	},
+}
+
+// RenderDocument executes the params' template against its vars and the build metadata,
+// returning the result only if it's a valid JSON object.
+func RenderDocument(inputDir string, params *OutParams, metadata BuildMetadata) ([]byte, error) {
+	text := params.InlineTemplate
+	if params.Template != "" {
+		templateBytes, err := ioutil.ReadFile(path.Join(inputDir, params.Template))
+		if err != nil {
+			return nil, fmt.Errorf("error reading template: %s", err)
+		}
+		text = string(templateBytes)
+	}
+
+	tmpl, err := template.New("document").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %s", err)
+	}
+
+	vars := map[string]interface{}{}
+	for key, value := range params.Vars {
+		vars[key] = value
+	}
+	for key, file := range params.VarFiles {
+		fileBytes, err := ioutil.ReadFile(path.Join(inputDir, file))
+		if err != nil {
+			return nil, fmt.Errorf("error reading var file %s: %s", key, err)
+		}
+		vars[key] = strings.TrimSpace(string(fileBytes))
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[string]interface{}{
+		"vars":  vars,
+		"build": metadata,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error rendering template: %s", err)
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &document); err != nil {
+		return nil, fmt.Errorf("rendered template is not a JSON object: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderSearch executes the search query as a template against the triggering document.
+func RenderSearch(search json.RawMessage, document map[string]interface{}) (map[string]interface{}, error) {
+	tmpl, err := template.New("search").Funcs(templateFuncs).Option("missingkey=error").Parse(string(search))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing search: %s", err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[string]interface{}{
+		"doc": document,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error rendering search: %s", err)
+	}
+
+	var query map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &query); err != nil {
+		return nil, fmt.Errorf("rendered search is not a JSON object: %s", err)
+	}
+	return query, nil
+}
@@ -0,0 +1,115 @@
+package concourse
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRenderDocument(t *testing.T) {
+	inputDir, err := ioutil.TempDir("", "render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(inputDir)
+	})
+
+	err = ioutil.WriteFile(path.Join(inputDir, "version"), []byte("1.2.3\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path.Join(inputDir, "event.tmpl"), []byte(`{"version":{{ json .vars.version }},"job":{{ json .build.JobName }}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Template file", func(t *testing.T) {
+		params := &OutParams{
+			Template: "event.tmpl",
+			VarFiles: map[string]string{"version": "version"},
+		}
+		rendered, err := RenderDocument(inputDir, params, BuildMetadata{JobName: "deploy"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(rendered, &doc); err != nil {
+			t.Error(err)
+			return
+		}
+		if doc["version"] != "1.2.3" || doc["job"] != "deploy" {
+			t.Errorf("Unexpected document: %s", rendered)
+			return
+		}
+	})
+
+	t.Run("Inline template", func(t *testing.T) {
+		params := &OutParams{
+			InlineTemplate: `{"status":{{ json .vars.status }}}`,
+			Vars:           map[string]interface{}{"status": "done"},
+		}
+		rendered, err := RenderDocument(inputDir, params, BuildMetadata{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if string(rendered) != `{"status":"done"}` {
+			t.Errorf("Unexpected document: %s", rendered)
+			return
+		}
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		params := &OutParams{
+			InlineTemplate: `{"status":{{ .vars.status }}}`,
+			Vars:           map[string]interface{}{"status": "done"},
+		}
+		_, err := RenderDocument(inputDir, params, BuildMetadata{})
+		if err == nil {
+			t.Error("Rendered document should fail validation")
+			return
+		}
+	})
+
+	t.Run("Missing var", func(t *testing.T) {
+		params := &OutParams{
+			InlineTemplate: `{"status":{{ json .vars.status }}}`,
+		}
+		_, err := RenderDocument(inputDir, params, BuildMetadata{})
+		if err == nil {
+			t.Error("Missing vars should fail rendering")
+			return
+		}
+	})
+}
+
+func TestRenderSearch(t *testing.T) {
+	document := map[string]interface{}{
+		"trace": map[string]interface{}{"id": "abc"},
+	}
+
+	t.Run("Inline search", func(t *testing.T) {
+		query, err := RenderSearch(json.RawMessage(`{"term":{"trace.id":"{{ .doc.trace.id }}"}}`), document)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		term, ok := query["term"].(map[string]interface{})
+		if !ok || term["trace.id"] != "abc" {
+			t.Errorf("Unexpected query: %v", query)
+			return
+		}
+	})
+
+	t.Run("Missing field", func(t *testing.T) {
+		_, err := RenderSearch(json.RawMessage(`{"term":{"span":"{{ .doc.span }}"}}`), document)
+		if err == nil {
+			t.Error("Missing fields should fail rendering")
+			return
+		}
+	})
+}
@@ -1,22 +1,177 @@
 package concourse
 
-import "github.com/dmarkwat/concourse-elasticsearch/pkg/es"
+import (
+	"encoding/json"
+	"github.com/dmarkwat/concourse-elasticsearch/pkg/es"
+)
+
+const (
+	ActionIndex         = "index"
+	ActionDelete        = "delete"
+	ActionTombstone     = "tombstone"
+	ActionSnapshot      = "snapshot"
+	ActionRestore       = "restore"
+	ActionReindex       = "reindex"
+	ActionAddAlias      = "add_alias"
+	ActionRemoveAlias   = "remove_alias"
+	ActionSwapAlias     = "swap_alias"
+	ActionRollover      = "rollover"
+	ActionWaitForHealth = "wait_for_health"
+)
+
+// What to track rather than documents: the snapshots in the source's repository, the indices matching its index,
+// or the health of the cluster (or its index).
+const (
+	TrackSnapshots = "snapshots"
+	TrackIndices   = "indices"
+	TrackHealth    = "health"
+)
+
+// DefaultHealthTimeout is how long wait_for_health waits when no timeout is given.
+const DefaultHealthTimeout = "5m"
+
+// DefaultReindexTimeout is how long reindex waits for its task when no timeout is given.
+const DefaultReindexTimeout = "1h"
+
+// Behaviours of in when the version no longer exists.
+const (
+	MissingFail   = "fail"
+	MissingIgnore = "ignore"
+)
+
+// DefaultSearchLimit caps the hits written by an in search when no limit is given.
+const DefaultSearchLimit = 10000
+
+// DefaultWindowLimit caps the documents written for an in context window when no limit is given.
+const DefaultWindowLimit = 10000
 
 type SourceConfig struct {
-	Addresses  []string `json:"addresses"`
-	Index      string   `json:"index"`
-	SortFields []string `json:"sort_fields"`
-	Username   string   `json:"username,omitempty"`
-	Password   string   `json:"password,omitempty"`
+	Addresses           []string               `json:"addresses"`
+	Index               string                 `json:"index"`
+	SortFields          []string               `json:"sort_fields"`
+	Routing             string                 `json:"routing,omitempty"`
+	Query               map[string]interface{} `json:"query,omitempty"`
+	InitialVersion      *InitialVersion        `json:"initial_version,omitempty"`
+	Lookback            string                 `json:"lookback,omitempty"`
+	EmitAllOnFirstCheck bool                   `json:"emit_all_on_first_check,omitempty"`
+	MaxVersionsPerCheck int                    `json:"max_versions_per_check,omitempty"`
+	Collapse            string                 `json:"collapse,omitempty"`
+	DedupeField         string                 `json:"dedupe_field,omitempty"`
+	TombstoneField      string                 `json:"tombstone_field,omitempty"`
+	TrackUpdates        bool                   `json:"track_updates,omitempty"`
+	UpdatedAtField      string                 `json:"updated_at_field,omitempty"`
+	Aggregation         *es.BucketAggregation  `json:"aggregation,omitempty"`
+	Threshold           *es.Threshold          `json:"threshold,omitempty"`
+	Includes            []string               `json:"includes,omitempty"`
+	Excludes            []string               `json:"excludes,omitempty"`
+	Track               string                 `json:"track,omitempty"`
+	SnapshotRepository  string                 `json:"snapshot_repository,omitempty"`
+	Health              string                 `json:"health,omitempty"`
+	Flavor              string                 `json:"flavor,omitempty"`
+	Username            string                 `json:"username,omitempty"`
+	Password            string                 `json:"password,omitempty"`
+}
+
+func (s *SourceConfig) Filter() es.Filter {
+	return es.Filter{
+		Query:          s.Query,
+		TombstoneField: s.TombstoneField,
+	}
+}
+
+// IndexFor is the index to fetch the version's document from: the concrete index the version was found in,
+// qualified by its cluster alias for cross-cluster sources, or else the source's index.
+func (s *SourceConfig) IndexFor(version *Version) string {
+	if version != nil && version.Index != "" {
+		return version.Index
+	}
+	return s.Index
+}
+
+// TracksDocuments reports whether versions are individual documents, as opposed to buckets, alerts or snapshots.
+func (s *SourceConfig) TracksDocuments() bool {
+	return s.Aggregation == nil && s.Threshold == nil && s.Track == ""
+}
+
+// InitialVersion pins where the first check starts from: either a document ID or the sort fields' values.
+type InitialVersion struct {
+	Id     string                 `json:"id,omitempty"`
+	Cursor map[string]interface{} `json:"cursor,omitempty"`
 }
 
 type InParams struct {
-	Document string `json:"document"`
+	Document     string `json:"document"`
+	SkipDownload bool   `json:"skip_download,omitempty"`
+	Missing      string `json:"missing,omitempty"`
+	// Includes and Excludes filter the document's fields, overriding the source's
+	Includes       []string `json:"includes,omitempty"`
+	Excludes       []string `json:"excludes,omitempty"`
+	DocvalueFields []string `json:"docvalue_fields,omitempty"`
+	StoredFields   []string `json:"stored_fields,omitempty"`
+	Before         int      `json:"before,omitempty"`
+	After          int      `json:"after,omitempty"`
+	Window         string   `json:"window,omitempty"`
+	WindowLimit    int      `json:"window_limit,omitempty"`
+	// Search is a query template, kept raw to be rendered against the document
+	Search      json.RawMessage `json:"search,omitempty"`
+	SearchIndex string          `json:"search_index,omitempty"`
+	SearchSort  []string        `json:"search_sort,omitempty"`
+	SearchLimit int             `json:"search_limit,omitempty"`
+	// Export writes every document matched by the source instead of the version's
+	Export *ExportParams `json:"export,omitempty"`
+}
+
+// Fields selects what's fetched of the version's document; includes and excludes default to the source's.
+func (r *InRequest) Fields() es.Fields {
+	fields := es.Fields{
+		Includes:       r.Source.Includes,
+		Excludes:       r.Source.Excludes,
+		DocvalueFields: r.Params.DocvalueFields,
+		StoredFields:   r.Params.StoredFields,
+	}
+	if len(r.Params.Includes) > 0 || len(r.Params.Excludes) > 0 {
+		fields.Includes = r.Params.Includes
+		fields.Excludes = r.Params.Excludes
+	}
+	return fields
+}
+
+// HasContext reports whether neighbouring documents are to be fetched alongside the version.
+func (p *InParams) HasContext() bool {
+	return p.Before > 0 || p.After > 0 || p.Window != ""
 }
 
 type OutParams struct {
-	Document string `json:"document"`
-	FieldMap map[string]es.PropertyMapping `json:"field_map,omitempty"`
+	Action              string                        `json:"action,omitempty"`
+	Id                  string                        `json:"id,omitempty"`
+	Query               map[string]interface{}        `json:"query,omitempty"`
+	Document            string                        `json:"document,omitempty"`
+	Template            string                        `json:"template,omitempty"`
+	InlineTemplate      string                        `json:"inline_template,omitempty"`
+	Vars                map[string]interface{}        `json:"vars,omitempty"`
+	VarFiles            map[string]string             `json:"var_files,omitempty"`
+	FieldMap            map[string]es.PropertyMapping `json:"field_map,omitempty"`
+	Refresh             string                        `json:"refresh,omitempty"`
+	WaitForActiveShards string                        `json:"wait_for_active_shards,omitempty"`
+	Enrich              *EnrichParams                 `json:"enrich,omitempty"`
+	Pipeline            string                        `json:"pipeline,omitempty"`
+	Routing             string                        `json:"routing,omitempty"`
+	Snapshot            string                        `json:"snapshot,omitempty"`
+	Indices             []string                      `json:"indices,omitempty"`
+	WaitForCompletion   bool                          `json:"wait_for_completion,omitempty"`
+	RenamePattern       string                        `json:"rename_pattern,omitempty"`
+	RenameReplacement   string                        `json:"rename_replacement,omitempty"`
+	Dest                string                        `json:"dest,omitempty"`
+	DestSortFields      []string                      `json:"dest_sort_fields,omitempty"`
+	Alias               string                        `json:"alias,omitempty"`
+	Conditions          *es.RolloverConditions        `json:"conditions,omitempty"`
+	NewIndex            string                        `json:"new_index,omitempty"`
+	Health              string                        `json:"health,omitempty"`
+	Timeout             string                        `json:"timeout,omitempty"`
+}
+
+type EnrichParams struct {
+	Key string `json:"key,omitempty"`
 }
 
 type Metadata struct {
@@ -25,7 +180,23 @@ type Metadata struct {
 }
 
 type Version struct {
-	Id string `json:"id"`
+	Id          string `json:"id"`
+	Index       string `json:"index,omitempty"`
+	Routing     string `json:"routing,omitempty"`
+	SeqNo       string `json:"seq_no,omitempty"`
+	PrimaryTerm string `json:"primary_term,omitempty"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+	DocCount    string `json:"doc_count,omitempty"`
+	Max         string `json:"max,omitempty"`
+	Value       string `json:"value,omitempty"`
+	WindowStart string `json:"window_start,omitempty"`
+	WindowEnd   string `json:"window_end,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	Health      string `json:"health,omitempty"`
+	// ObservedAt is when a tracked status was seen, keeping a return to an earlier status a new version
+	ObservedAt       string `json:"observed_at,omitempty"`
+	ActiveShards     string `json:"active_shards,omitempty"`
+	UnassignedShards string `json:"unassigned_shards,omitempty"`
 }
 
 type CheckRequest struct {
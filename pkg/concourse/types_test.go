@@ -0,0 +1,38 @@
+package concourse
+
+import "testing"
+
+func TestSourceConfigIndexFor(t *testing.T) {
+	source := SourceConfig{Index: "remote:events-*"}
+	if index := source.IndexFor(nil); index != "remote:events-*" {
+		t.Errorf("Expected the source index; got %s", index)
+		return
+	}
+	if index := source.IndexFor(&Version{Id: "1"}); index != "remote:events-*" {
+		t.Errorf("Expected the source index; got %s", index)
+		return
+	}
+	if index := source.IndexFor(&Version{Id: "1", Index: "remote:events-2020"}); index != "remote:events-2020" {
+		t.Errorf("Expected the version's index; got %s", index)
+		return
+	}
+}
+
+func TestInRequestFields(t *testing.T) {
+	request := InRequest{
+		Source: SourceConfig{Excludes: []string{"payload"}},
+		Params: &InParams{StoredFields: []string{"title"}},
+	}
+	fields := request.Fields()
+	if len(fields.Excludes) != 1 || len(fields.StoredFields) != 1 {
+		t.Errorf("Expected the source's excludes; got %v", fields)
+		return
+	}
+
+	request.Params.Includes = []string{"message"}
+	fields = request.Fields()
+	if len(fields.Includes) != 1 || len(fields.Excludes) != 0 {
+		t.Errorf("Expected the params' includes only; got %v", fields)
+		return
+	}
+}
@@ -0,0 +1,267 @@
+package es
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const (
+	AggregationTerms         = "terms"
+	AggregationDateHistogram = "date_histogram"
+)
+
+// BucketAggregation configures a terms or date_histogram aggregation whose buckets are tracked as versions.
+type BucketAggregation struct {
+	Type             string `json:"type"`
+	Field            string `json:"field"`
+	CalendarInterval string `json:"calendar_interval,omitempty"`
+	FixedInterval    string `json:"fixed_interval,omitempty"`
+	// MaxField, e.g. a timestamp, orders terms buckets from oldest to newest and is tracked alongside the doc count
+	MaxField     string `json:"max_field,omitempty"`
+	Size         int    `json:"size,omitempty"`
+	TopHits      int    `json:"top_hits,omitempty"`
+	TrackChanges bool   `json:"track_changes,omitempty"`
+}
+
+type Bucket struct {
+	Key      string
+	DocCount int64
+	Max      *float64
+	TopHits  []Hit
+}
+
+func (agg *BucketAggregation) Validate() error {
+	switch agg.Type {
+	case AggregationTerms:
+		if agg.MaxField == "" {
+			return fmt.Errorf("terms aggregation requires max_field to order its buckets")
+		}
+	case AggregationDateHistogram:
+		if (agg.CalendarInterval == "") == (agg.FixedInterval == "") {
+			return fmt.Errorf("date_histogram requires one of calendar_interval or fixed_interval")
+		}
+	default:
+		return fmt.Errorf("invalid aggregation type: %s", agg.Type)
+	}
+	if agg.Field == "" {
+		return fmt.Errorf("aggregation field required")
+	}
+	return nil
+}
+
+func (agg *BucketAggregation) body(capabilities Capabilities, topHits int) map[string]interface{} {
+	body := map[string]interface{}{
+		"field": agg.Field,
+	}
+	size := agg.Size
+	if size == 0 {
+		size = 10
+	}
+	switch agg.Type {
+	case AggregationTerms:
+		body["size"] = size
+		// the most recent buckets by max value rather than the default, most documents
+		body["order"] = map[string]interface{}{"max": "desc"}
+	case AggregationDateHistogram:
+		if !capabilities.CalendarInterval {
+			// prior to 7.2 both are given as interval
+			body["interval"] = agg.CalendarInterval + agg.FixedInterval
+		} else if agg.CalendarInterval != "" {
+			body["calendar_interval"] = agg.CalendarInterval
+		} else {
+			body["fixed_interval"] = agg.FixedInterval
+		}
+		body["min_doc_count"] = 1
+	}
+
+	subAggs := map[string]interface{}{}
+	if agg.MaxField != "" {
+		subAggs["max"] = map[string]interface{}{
+			"max": map[string]interface{}{"field": agg.MaxField},
+		}
+	}
+	if topHits > 0 {
+		subAggs["top"] = map[string]interface{}{
+			"top_hits": map[string]interface{}{"size": topHits},
+		}
+	}
+
+	aggregation := map[string]interface{}{
+		agg.Type: body,
+	}
+	if len(subAggs) > 0 {
+		aggregation["aggs"] = subAggs
+	}
+	return aggregation
+}
+
+// Buckets runs the aggregation, returning its buckets from oldest to newest:
+// by key for date histograms and by max value for terms.
+// If key is set, only documents belonging to that bucket or, for date histograms, later buckets are aggregated
+// and the bucket's top hits are fetched.
+func Buckets(client *Client, index string, agg *BucketAggregation, filter Filter, key string) ([]Bucket, error) {
+	if err := agg.Validate(); err != nil {
+		return nil, err
+	}
+
+	bucketFilter := map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	}
+	topHits := 0
+	if key != "" {
+		topHits = agg.TopHits
+		if topHits == 0 {
+			topHits = 10
+		}
+		if agg.Type == AggregationTerms {
+			bucketFilter = map[string]interface{}{
+				"term": map[string]interface{}{agg.Field: key},
+			}
+		} else {
+			bucketFilter = keyRange(agg, key)
+		}
+	}
+
+	buckets, err := aggregate(client, index, agg, filter.apply(bucketFilter), topHits)
+	if err != nil || key == "" {
+		return buckets, err
+	}
+	for _, bucket := range buckets {
+		if bucket.Key == key {
+			return []Bucket{bucket}, nil
+		}
+	}
+	return nil, nil
+}
+
+// BucketsFrom runs the aggregation like Buckets, without top hits, returning the buckets from key's on.
+// Date histograms only aggregate the documents in or after key's bucket, or only the latest bucket if key is empty,
+// so they never exceed the cluster's bucket limit; terms are already bounded by their size.
+func BucketsFrom(client *Client, index string, agg *BucketAggregation, filter Filter, key string) ([]Bucket, error) {
+	if err := agg.Validate(); err != nil {
+		return nil, err
+	}
+
+	bucketFilter := map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	}
+	if agg.Type == AggregationDateHistogram {
+		if key != "" {
+			bucketFilter = keyRange(agg, key)
+		} else {
+			latest, err := maxValue(client, index, agg.Field, filter)
+			if err != nil || latest == nil {
+				return nil, err
+			}
+			// the bucket holding the latest document is the only one with documents from then on
+			bucketFilter = map[string]interface{}{
+				"range": map[string]interface{}{
+					agg.Field: map[string]interface{}{
+						"gte":    FormatValue(*latest),
+						"format": "epoch_millis",
+					},
+				},
+			}
+		}
+	}
+
+	buckets, err := aggregate(client, index, agg, filter.apply(bucketFilter), 0)
+	if err != nil || key == "" {
+		return buckets, err
+	}
+	for i, bucket := range buckets {
+		if bucket.Key == key {
+			return buckets[i:], nil
+		}
+	}
+	return nil, nil
+}
+
+// keyRange matches the documents in or after the date histogram bucket with the given key.
+func keyRange(agg *BucketAggregation, key string) map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			agg.Field: map[string]interface{}{"gte": key},
+		},
+	}
+}
+
+// maxValue is the max value of field over the filtered documents, or nil if there are none.
+func maxValue(client *Client, index string, field string, filter Filter) (*float64, error) {
+	query := map[string]interface{}{
+		"query": filter.apply(map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		}),
+		"size": 0,
+		"aggs": map[string]interface{}{
+			"metric": map[string]interface{}{
+				"max": map[string]interface{}{"field": field},
+			},
+		},
+	}
+	envelope, err := search(client, index, query)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Aggregations.Metric.Value, nil
+}
+
+// aggregate runs the aggregation over the documents matching query, returning its buckets from oldest to newest.
+func aggregate(client *Client, index string, agg *BucketAggregation, query map[string]interface{}, topHits int) ([]Bucket, error) {
+	envelope, err := search(client, index, map[string]interface{}{
+		"query": query,
+		"size":  0,
+		"aggs": map[string]interface{}{
+			"versions": agg.body(client.Capabilities, topHits),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []Bucket
+	for _, raw := range envelope.Aggregations.Versions.Buckets {
+		bucket := Bucket{
+			Key:      raw.KeyAsString,
+			DocCount: raw.DocCount,
+			Max:      raw.Max.Value,
+			TopHits:  raw.Top.Hits.Hits,
+		}
+		if bucket.Key == "" {
+			bucket.Key = keyString(raw.Key)
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	if agg.Type == AggregationTerms {
+		sort.SliceStable(buckets, func(i, j int) bool {
+			// buckets without a max value have none of their documents dated, so are taken as the oldest
+			if buckets[i].Max == nil || buckets[j].Max == nil {
+				return buckets[i].Max == nil && buckets[j].Max != nil
+			}
+			return *buckets[i].Max < *buckets[j].Max
+		})
+	}
+	return buckets, nil
+}
+
+func keyString(key json.RawMessage) string {
+	var str string
+	if err := json.Unmarshal(key, &str); err == nil {
+		return str
+	}
+	var num json.Number
+	if err := json.Unmarshal(key, &num); err == nil {
+		return num.String()
+	}
+	return string(key)
+}
+
+// FormatMax renders a bucket's max value for use in a version.
+func (b *Bucket) FormatMax() string {
+	if b.Max == nil {
+		return ""
+	}
+	return FormatValue(*b.Max)
+}
@@ -0,0 +1,106 @@
+package es
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuckets(t *testing.T) {
+	settings := map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"release":   map[string]interface{}{"type": "keyword"},
+				"timestamp": map[string]interface{}{"type": "date"},
+			},
+		},
+	}
+	agg := &BucketAggregation{
+		Type:     AggregationTerms,
+		Field:    "release",
+		MaxField: "timestamp",
+	}
+	es := NewTestClient()
+
+	index, err := NewIndex(es, "buckets", settings)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, index))
+
+	for _, doc := range []string{
+		`{"release": "v1", "timestamp": "2020-05-10T00:00:00.000Z"}`,
+		`{"release": "v1", "timestamp": "2020-05-10T01:00:00.000Z"}`,
+		`{"release": "v2", "timestamp": "2020-05-10T02:00:00.000Z"}`,
+	} {
+		res, err := es.Index(index, strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if res.IsError() {
+			t.Fatal(res.String())
+			return
+		}
+	}
+	err = RefreshIndex(es, index)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	t.Run("All buckets", func(t *testing.T) {
+		buckets, err := Buckets(es, index, agg, Filter{}, "")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(buckets) != 2 || buckets[0].Key != "v1" || buckets[1].Key != "v2" {
+			t.Errorf("Expected buckets v1 then v2; got %v", buckets)
+			return
+		}
+		if buckets[0].DocCount != 2 {
+			t.Errorf("Expected 2 documents in v1; got %d", buckets[0].DocCount)
+			return
+		}
+	})
+
+	t.Run("Single bucket", func(t *testing.T) {
+		buckets, err := Buckets(es, index, agg, Filter{}, "v1")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(buckets) != 1 || len(buckets[0].TopHits) != 2 {
+			t.Errorf("Expected v1 with its 2 top hits; got %v", buckets)
+			return
+		}
+	})
+
+	t.Run("Histogram from a bucket", func(t *testing.T) {
+		histogram := &BucketAggregation{
+			Type:          AggregationDateHistogram,
+			Field:         "timestamp",
+			FixedInterval: "1h",
+		}
+		buckets, err := BucketsFrom(es, index, histogram, Filter{}, "2020-05-10T01:00:00.000Z")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(buckets) != 2 || buckets[0].Key != "2020-05-10T01:00:00.000Z" {
+			t.Errorf("Expected the 01:00 and 02:00 buckets; got %v", buckets)
+			return
+		}
+
+		buckets, err = BucketsFrom(es, index, histogram, Filter{}, "")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(buckets) != 1 || buckets[0].Key != "2020-05-10T02:00:00.000Z" {
+			t.Errorf("Expected only the latest bucket; got %v", buckets)
+			return
+		}
+	})
+}
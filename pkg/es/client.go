@@ -7,10 +7,28 @@ import (
 	"errors"
 	"fmt"
 	elastic "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
 	"log"
+	"sort"
+	"strings"
 )
 
-func NewClient(addresses []string, username string, password string) (*elastic.Client, error) {
+const (
+	// the default search.max_buckets prior to 7.9
+	maxBuckets = 10000
+)
+
+var (
+	pageSize = 1000
+	// testHookPage is called between pages of searchAll, so tests can change the index mid-search
+	testHookPage = func() {}
+)
+
+// NewClient connects to the cluster and determines its capabilities.
+// The flavor, elasticsearch or opensearch, is detected from the cluster's info if empty.
+//
+// Note: the elastic client is kept below 7.14, which refuses to talk to anything failing its product check (e.g. OpenSearch).
+func NewClient(addresses []string, username string, password string, flavor string) (*Client, error) {
 	cfg := elastic.Config{
 		Addresses: addresses,
 		Username:  username,
@@ -22,15 +40,36 @@ func NewClient(addresses []string, username string, password string) (*elastic.C
 		return nil, err
 	}
 
-	info, err := client.Info()
+	info, err := newClusterInfo(client)
+	if err != nil {
+		return nil, err
+	}
+	capabilities, err := NewCapabilities(info, flavor)
 	if err != nil {
 		return nil, err
 	}
-	log.Println(info)
-	return client, nil
+	log.Printf("Connected to %s cluster %s (%s)", capabilities.Flavor, info.Name, info.Version.Number)
+	return &Client{
+		Client:       client,
+		Info:         info,
+		Capabilities: capabilities,
+	}, nil
 }
 
-func IndexExists(client *elastic.Client, index string) (bool, error) {
+// IsRemote reports whether the index expression targets a remote cluster using cross-cluster syntax, e.g. remote:events-*.
+func IsRemote(index string) bool {
+	for _, part := range strings.Split(index, ",") {
+		if strings.Contains(part, ":") {
+			return true
+		}
+	}
+	return false
+}
+
+func IndexExists(client *Client, index string) (bool, error) {
+	if IsRemote(index) {
+		return remoteIndexExists(client, index)
+	}
 	exists, err := client.Indices.Exists([]string{index})
 	if err != nil {
 		return false, fmt.Errorf(err.Error())
@@ -39,23 +78,44 @@ func IndexExists(client *elastic.Client, index string) (bool, error) {
 	return exists.StatusCode == 200, nil
 }
 
-func FindById(client *elastic.Client, index string, id string) (map[string]interface{}, error) {
-	var buf bytes.Buffer
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"match": map[string]interface{}{
-				"_id": id,
-			},
-		},
+// remoteIndexExists checks for remote indices with an empty search, as the exists API is local only.
+func remoteIndexExists(client *Client, index string) (bool, error) {
+	res, err := client.Search(
+		client.Search.WithContext(context.Background()),
+		client.Search.WithIndex(index),
+		client.Search.WithSize(0),
+		client.Search.WithAllowNoIndices(false),
+		client.Search.WithIgnoreUnavailable(false),
+	)
+	if err != nil {
+		return false, fmt.Errorf("error getting response: %s", err)
 	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return false, nil
+	}
+	if res.IsError() {
+		return false, errors.New(res.String())
+	}
+	return true, nil
+}
+
+// search executes the query against the index and decodes the response envelope.
+func search(client *Client, index string, query map[string]interface{}, opts ...func(*esapi.SearchRequest)) (*EnvelopeResponse, error) {
+	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(query); err != nil {
 		return nil, fmt.Errorf("error encoding query: %s", err)
 	}
-	res, err := client.Search(
+	log.Printf("Executing query, %s", buf.String())
+	opts = append([]func(*esapi.SearchRequest){
 		client.Search.WithContext(context.Background()),
-		client.Search.WithIndex(index),
 		client.Search.WithBody(&buf),
-	)
+	}, opts...)
+	// point in time searches are bound to their indices already
+	if index != "" {
+		opts = append(opts, client.Search.WithIndex(index))
+	}
+	res, err := client.Search(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error getting response: %s", err)
 	}
@@ -69,14 +129,22 @@ func FindById(client *elastic.Client, index string, id string) (map[string]inter
 	if err != nil {
 		return nil, fmt.Errorf(err.Error())
 	}
+	return &envelope, nil
+}
 
-	if envelope.Hits.Total.Value != 1 {
-		// it needs to be OK for the document to go missing
-		return nil, nil
+// FindById returns the document's _source, or nil if it doesn't exist.
+func FindById(client *Client, index string, id string, routing string, fields Fields) (map[string]interface{}, error) {
+	hit, err := FindHitById(client, index, id, routing, fields)
+	if err != nil || hit == nil {
+		return nil, err
 	}
 
-	var obj map[string]interface{}
-	err = json.Unmarshal(envelope.Hits.Hits[0].Source, &obj)
+	obj := map[string]interface{}{}
+	if len(hit.Source) == 0 {
+		// the _source was disabled or filtered out entirely
+		return obj, nil
+	}
+	err = json.Unmarshal(hit.Source, &obj)
 	if err != nil {
 		return nil, fmt.Errorf(err.Error())
 	}
@@ -84,7 +152,34 @@ func FindById(client *elastic.Client, index string, id string) (map[string]inter
 	return obj, nil
 }
 
-func LatestBySortFields(client *elastic.Client, index string, sortFields []string, document map[string]interface{}) ([]string, error) {
+// FindHitById is like FindById but returns the whole hit, including any docvalue and stored fields.
+func FindHitById(client *Client, index string, id string, routing string, fields Fields) (*Hit, error) {
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match": map[string]interface{}{
+				"_id": id,
+			},
+		},
+	}
+	fields.apply(query)
+	var opts []func(*esapi.SearchRequest)
+	if routing != "" {
+		opts = append(opts, client.Search.WithRouting(routing))
+	}
+	envelope, err := search(client, index, query, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if envelope.Hits.Total.Value != 1 {
+		// it needs to be OK for the document to go missing
+		return nil, nil
+	}
+
+	return &envelope.Hits.Hits[0], nil
+}
+
+func LatestBySortFields(client *Client, index string, sortFields []string, filter Filter, document map[string]interface{}) ([]Hit, error) {
 	if len(sortFields) == 0 {
 		return nil, fmt.Errorf("must have at least one sorted field")
 	}
@@ -99,70 +194,409 @@ func LatestBySortFields(client *elastic.Client, index string, sortFields []strin
 		}
 
 		query = map[string]interface{}{
-			"query": map[string]interface{}{
+			"query": filter.apply(map[string]interface{}{
 				"match_all": map[string]interface{}{},
-			},
+			}),
 			"sort": sortProcessor,
 			"size": 1,
 		}
 	} else {
-		rangeQuery := map[string]interface{}{}
-		for _, field := range sortFields {
-			value, ok := document[field]
-			if !ok {
-				return nil, fmt.Errorf("field not found in doc: %s", field)
+		return SinceBySortFields(client, index, sortFields, filter, &Cursor{Values: document}, "", 0)
+	}
+
+	envelope, err := search(client, index, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope.Hits.Hits, nil
+}
+
+// SinceBySortFields returns the documents from the cursor on, in ascending order, stopping at the limit if non-zero.
+// A nil cursor returns every document. If collapse is set, only the latest document for each of its values is returned.
+func SinceBySortFields(client *Client, index string, sortFields []string, filter Filter, cursor *Cursor, collapse string, limit int) ([]Hit, error) {
+	if len(sortFields) == 0 {
+		return nil, fmt.Errorf("must have at least one sorted field")
+	}
+
+	clause, err := cursorClause(client, index, sortFields, cursor)
+	if err != nil {
+		return nil, err
+	}
+	if collapse != "" {
+		return collapseLatest(client, index, sortFields, filter.apply(clause), collapse, limit, nil)
+	}
+
+	query := map[string]interface{}{
+		"query": filter.apply(clause),
+		"sort":  cursorSort(client, sortFields, "asc"),
+	}
+	return searchAll(client, index, query, limit)
+}
+
+// DedupeBySortFields is like SinceBySortFields but returns only the latest document for each distinct value of the field,
+// paging through a composite aggregation so duplicates are removed across every document since the cursor.
+// Documents without the field are ignored.
+func DedupeBySortFields(client *Client, index string, sortFields []string, filter Filter, cursor *Cursor, field string, limit int) ([]Hit, error) {
+	if len(sortFields) == 0 {
+		return nil, fmt.Errorf("must have at least one sorted field")
+	}
+
+	clause, err := cursorClause(client, index, sortFields, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var sortProcessor []map[string]interface{}
+	for _, sortField := range sortFields {
+		sortProcessor = append(sortProcessor, map[string]interface{}{
+			sortField: "desc",
+		})
+	}
+
+	composite := map[string]interface{}{
+		"size": pageSize,
+		"sources": []map[string]interface{}{
+			{
+				field: map[string]interface{}{
+					"terms": map[string]interface{}{
+						"field": field,
+					},
+				},
+			},
+		},
+	}
+	query := map[string]interface{}{
+		"query": filter.apply(clause),
+		"size":  0,
+		"aggs": map[string]interface{}{
+			"versions": map[string]interface{}{
+				"composite": composite,
+				"aggs": map[string]interface{}{
+					"top": map[string]interface{}{
+						"top_hits": map[string]interface{}{
+							"size": 1,
+							"sort": sortProcessor,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// every value's latest document is needed before the limit can be applied in sort order
+	var hits []Hit
+	for {
+		envelope, err := search(client, index, query)
+		if err != nil {
+			return nil, err
+		}
+		versions := envelope.Aggregations.Versions
+		for _, bucket := range versions.Buckets {
+			hits = append(hits, bucket.Top.Hits.Hits...)
+		}
+		if len(versions.Buckets) < pageSize || len(versions.AfterKey) == 0 {
+			break
+		}
+		composite["after"] = versions.AfterKey
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return compareSort(hits[i].Sort, hits[j].Sort) < 0
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// compareSort orders hits' sort values, comparing numbers numerically and anything else by its JSON text.
+func compareSort(a []json.RawMessage, b []json.RawMessage) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		var x, y float64
+		if json.Unmarshal(a[i], &x) == nil && json.Unmarshal(b[i], &y) == nil {
+			if x < y {
+				return -1
+			} else if x > y {
+				return 1
 			}
-			rangeQuery[field] = map[string]interface{}{
-				"gte": value,
+			continue
+		}
+		if c := strings.Compare(string(a[i]), string(b[i])); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+// searchAll pages through the sorted query's hits, stopping at the limit if non-zero.
+func searchAll(client *Client, index string, query map[string]interface{}, limit int) ([]Hit, error) {
+	var hits []Hit
+	err := searchPages(client, index, query, limit, func(page []Hit) error {
+		hits = append(hits, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+// searchPages passes each page of the sorted query's hits to the page func, stopping at the limit if non-zero.
+// Pages are read from a point in time using search_after or, where points in time aren't supported, from a scroll,
+// so documents indexed mid-check aren't skipped or repeated.
+func searchPages(client *Client, index string, query map[string]interface{}, limit int, page func([]Hit) error) error {
+	// points in time are opened on the local cluster only
+	if !client.Capabilities.PointInTime || IsRemote(index) {
+		return scrollPages(client, index, query, limit, page)
+	}
+
+	pit, err := openPointInTime(client, index)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the point in time expires regardless; closing just frees it sooner
+		if err := closePointInTime(client, pit); err != nil {
+			log.Printf("Error closing point in time: %s", err)
+		}
+	}()
+	query["pit"] = map[string]interface{}{
+		"id":         pit,
+		"keep_alive": pitKeepAlive,
+	}
+
+	// tiebreaker so pages don't split documents sharing sort values
+	tiebreaker := ""
+	if client.Capabilities.ShardDoc {
+		tiebreaker = "_shard_doc"
+	} else if client.Capabilities.IdSort {
+		tiebreaker = "_id"
+	}
+	sortProcessor := query["sort"].([]map[string]interface{})
+	// sorts already tie-broken by _id to continue from a cursor keep it
+	if _, ok := sortProcessor[len(sortProcessor)-1]["_id"]; !ok && tiebreaker != "" {
+		query["sort"] = append(sortProcessor, map[string]interface{}{
+			tiebreaker: "asc",
+		})
+	}
+
+	total := 0
+	for {
+		size := pageSize
+		if limit > 0 && limit-total < size {
+			size = limit - total
+		}
+		query["size"] = size
+
+		// point in time searches are bound to their indices already
+		envelope, err := search(client, "", query)
+		if err != nil {
+			return err
+		}
+		total += len(envelope.Hits.Hits)
+		if len(envelope.Hits.Hits) > 0 {
+			if err := page(envelope.Hits.Hits); err != nil {
+				return err
 			}
 		}
 
-		query = map[string]interface{}{
-			"query": map[string]interface{}{
-				"range": rangeQuery,
-			},
+		if len(envelope.Hits.Hits) < size || (limit > 0 && total >= limit) {
+			return nil
+		}
+		testHookPage()
+		query["search_after"] = envelope.Hits.Hits[len(envelope.Hits.Hits)-1].Sort
+		if envelope.PitId != "" {
+			// the point in time's ID may change between pages
+			pit = envelope.PitId
+			query["pit"].(map[string]interface{})["id"] = pit
 		}
 	}
+}
 
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(query); err != nil {
-		return nil, fmt.Errorf("error encoding query: %s", err)
+// Search pages through every hit of an arbitrary query, ordered ascending by the sort fields, stopping at the limit
+// if non-zero.
+func Search(client *Client, index string, query map[string]interface{}, sortFields []string, fields Fields, limit int) ([]Hit, error) {
+	var hits []Hit
+	err := SearchPages(client, index, query, sortFields, fields, limit, func(page []Hit) error {
+		hits = append(hits, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	log.Printf("Executing query, %s", buf.String())
-	res, err := client.Search(
-		client.Search.WithContext(context.Background()),
-		client.Search.WithIndex(index),
-		client.Search.WithBody(&buf),
+	return hits, nil
+}
+
+// SearchPages is like Search but passes each page of hits to the page func as it's read,
+// so every hit needn't be held at once.
+func SearchPages(client *Client, index string, query map[string]interface{}, sortFields []string, fields Fields, limit int, page func([]Hit) error) error {
+	if len(sortFields) == 0 {
+		return fmt.Errorf("must have at least one sorted field")
+	}
+
+	sortProcessor := []map[string]interface{}{}
+	for _, field := range sortFields {
+		sortProcessor = append(sortProcessor, map[string]interface{}{
+			field: "asc",
+		})
+	}
+	body := map[string]interface{}{
+		"query": query,
+		"sort":  sortProcessor,
+	}
+	fields.apply(body)
+	return searchPages(client, index, body, limit, page)
+}
+
+// singleShard ensures the index resolves to exactly one index with a single primary shard,
+// since _seq_no is only ordered within a shard.
+func singleShard(client *Client, index string) error {
+	if IsRemote(index) {
+		return fmt.Errorf("revisions of cross-cluster index %s can't be tracked by _seq_no", index)
+	}
+	res, err := client.Cat.Indices(
+		client.Cat.Indices.WithContext(context.Background()),
+		client.Cat.Indices.WithIndex(index),
+		client.Cat.Indices.WithFormat("json"),
+		client.Cat.Indices.WithH("index", "pri"),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("error getting response: %s", err)
+		return fmt.Errorf("error getting response: %s", err)
 	}
+	defer res.Body.Close()
 	if res.IsError() {
-		return nil, errors.New(res.String())
+		return errors.New(res.String())
+	}
+	var indices []struct {
+		Index string `json:"index"`
+		Pri   string `json:"pri"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return fmt.Errorf(err.Error())
 	}
-	defer res.Body.Close()
 
-	var envelope EnvelopeResponse
-	err = json.NewDecoder(res.Body).Decode(&envelope)
+	if len(indices) != 1 {
+		return fmt.Errorf("revisions can only be tracked by _seq_no within a single index; %s matches %d", index, len(indices))
+	}
+	if indices[0].Pri != "1" {
+		return fmt.Errorf("revisions can only be tracked by _seq_no within a single primary shard; %s has %s", indices[0].Index, indices[0].Pri)
+	}
+	return nil
+}
+
+// LatestRevisions is like LatestBySortFields but orders documents by a field that changes with every revision,
+// e.g. _seq_no or an updated-at timestamp, so updated documents are returned again.
+// _seq_no is only ordered within a shard, so it can only be used for an index with a single primary shard.
+// The cursor is the current version's revision: its ID and revision field's value. A nil cursor fetches only the
+// latest revision. Revisions tied with the cursor's are told apart by _id, so a revision rewritten at the cursor's
+// _seq_no under a new primary term isn't returned again. A limit of 0 pages through all revisions after the cursor.
+// If collapse is set, only the latest revision for each of its values is returned.
+func LatestRevisions(client *Client, index string, revisionField string, filter Filter, cursor *Cursor, collapse string, limit int) ([]Hit, error) {
+	if revisionField == "" {
+		return nil, fmt.Errorf("revision field required")
+	} else if revisionField == "_seq_no" {
+		if !client.Capabilities.SeqNoPrimaryTerm {
+			return nil, fmt.Errorf("cluster version %s doesn't support tracking revisions by _seq_no", client.Info.Version.Number)
+		}
+		if err := singleShard(client, index); err != nil {
+			return nil, fmt.Errorf("%s; set updated_at_field instead", err)
+		}
+	}
+
+	if cursor == nil {
+		query := map[string]interface{}{
+			"query": filter.apply(map[string]interface{}{
+				"match_all": map[string]interface{}{},
+			}),
+			"sort": []map[string]interface{}{
+				{revisionField: "desc"},
+			},
+			"size": 1,
+		}
+		if client.Capabilities.SeqNoPrimaryTerm {
+			// 6.0 to 6.6 reject the option, even when false
+			query["seq_no_primary_term"] = true
+		}
+		envelope, err := search(client, index, query)
+		if err != nil {
+			return nil, err
+		}
+		return envelope.Hits.Hits, nil
+	}
+
+	sortFields := []string{revisionField}
+	clause, err := cursorClause(client, index, sortFields, cursor)
 	if err != nil {
-		return nil, fmt.Errorf(err.Error())
+		return nil, err
+	}
+	options := map[string]interface{}{}
+	if client.Capabilities.SeqNoPrimaryTerm {
+		options["seq_no_primary_term"] = true
+	}
+	if collapse != "" {
+		return collapseLatest(client, index, sortFields, filter.apply(clause), collapse, limit, options)
 	}
 
-	var ids []string
-	for _, hit := range envelope.Hits.Hits {
-		ids = append(ids, hit.ID)
+	query := map[string]interface{}{
+		"query": filter.apply(clause),
+		"sort":  cursorSort(client, sortFields, "asc"),
 	}
+	for key, value := range options {
+		query[key] = value
+	}
+	return searchAll(client, index, query, limit)
+}
 
-	return ids, nil
+func CreateIndex(client *Client, index string, fieldMap map[string]PropertyMapping, sortFields []string) error {
+	return createIndex(client, index, "_doc", map[string]interface{}{}, fieldMap, sortFields)
+}
+
+// CreateIndexFrom creates the index with the source index's mappings, the field map's types taking precedence.
+func CreateIndexFrom(client *Client, index string, source string, fieldMap map[string]PropertyMapping, sortFields []string) error {
+	details, err := GetIndexDetails(client, source)
+	if err != nil {
+		return err
+	}
+	if details == nil {
+		return fmt.Errorf("index (%s) doesn't exist", source)
+	}
+	mappings := map[string]interface{}{}
+	if len(details.Mappings) > 0 {
+		if err := json.Unmarshal(details.Mappings, &mappings); err != nil {
+			return err
+		}
+	}
+	typeName := "_doc"
+	if !client.Capabilities.Typeless {
+		// 6.x indices have a single mapping type, which reindexed documents keep
+		typed := mappings
+		mappings = map[string]interface{}{}
+		for name, typeMappings := range typed {
+			typeName = name
+			if m, ok := typeMappings.(map[string]interface{}); ok {
+				mappings = m
+			}
+		}
+	}
+	return createIndex(client, index, typeName, mappings, fieldMap, sortFields)
 }
 
-func CreateIndex(client *elastic.Client, index string, fieldMap map[string]PropertyMapping, sortFields []string) error {
-	properties := map[string]interface{}{}
+func createIndex(client *Client, index string, typeName string, mappings map[string]interface{}, fieldMap map[string]PropertyMapping, sortFields []string) error {
+	properties, ok := mappings["properties"].(map[string]interface{})
+	if !ok {
+		properties = map[string]interface{}{}
+	}
 	for key, val := range fieldMap {
 		properties[key] = map[string]interface{}{
 			"type": val.Type,
 		}
 	}
+	mappings["properties"] = properties
+	if !client.Capabilities.Typeless {
+		mappings = map[string]interface{}{
+			typeName: mappings,
+		}
+	}
 	settings := map[string]interface{}{
 		"settings": map[string]interface{}{
 			"index": map[string]interface{}{
@@ -171,9 +605,7 @@ func CreateIndex(client *elastic.Client, index string, fieldMap map[string]Prope
 				"sort.missing": "_first",
 			},
 		},
-		"mappings": map[string]interface{}{
-			"properties": properties,
-		},
+		"mappings": mappings,
 	}
 	marshal, err := json.Marshal(settings)
 	if err != nil {
@@ -188,3 +620,19 @@ func CreateIndex(client *elastic.Client, index string, fieldMap map[string]Prope
 	}
 	return nil
 }
+
+// FieldValue looks up a possibly dotted field path in a document's source.
+func FieldValue(source map[string]interface{}, field string) (interface{}, bool) {
+	if value, ok := source[field]; ok {
+		return value, true
+	}
+	parts := strings.SplitN(field, ".", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+	nested, ok := source[parts[0]].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return FieldValue(nested, parts[1])
+}
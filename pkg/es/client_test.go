@@ -15,7 +15,7 @@ import (
 	"time"
 )
 
-func NewTestClient() *elastic.Client {
+func NewTestClient() *Client {
 	es, err := elastic.NewDefaultClient()
 	if err != nil {
 		return nil
@@ -26,14 +26,26 @@ func NewTestClient() *elastic.Client {
 	if err != nil {
 		return nil
 	}
-	return es
+	info, err := newClusterInfo(es)
+	if err != nil {
+		return nil
+	}
+	capabilities, err := NewCapabilities(info, "")
+	if err != nil {
+		return nil
+	}
+	return &Client{
+		Client:       es,
+		Info:         info,
+		Capabilities: capabilities,
+	}
 }
 
 func NewIndexName(prefix string) string {
 	return fmt.Sprintf("%s-%s", prefix, uuid.New().String())
 }
 
-func NewIndex(es *elastic.Client, indexPrefix string, settings map[string]interface{}) (string, error) {
+func NewIndex(es *Client, indexPrefix string, settings map[string]interface{}) (string, error) {
 	index := NewIndexName(indexPrefix)
 	var request []func(*esapi.IndicesCreateRequest)
 	if settings != nil {
@@ -53,7 +65,7 @@ func NewIndex(es *elastic.Client, indexPrefix string, settings map[string]interf
 	return index, nil
 }
 
-func RefreshIndex(es *elastic.Client, index string) error {
+func RefreshIndex(es *Client, index string) error {
 	refresh, err := es.Indices.Refresh(es.Indices.Refresh.WithIndex(index))
 	if err != nil {
 		return err
@@ -64,7 +76,7 @@ func RefreshIndex(es *elastic.Client, index string) error {
 	return nil
 }
 
-func CleanupIndex(t *testing.T, es *elastic.Client, index string) func() {
+func CleanupIndex(t *testing.T, es *Client, index string) func() {
 	return func() {
 		res, err := es.Indices.Delete([]string{index})
 		if err != nil {
@@ -78,14 +90,14 @@ func CleanupIndex(t *testing.T, es *elastic.Client, index string) func() {
 
 func TestNewClient(t *testing.T) {
 	t.Run("Bad addresses", func(t *testing.T) {
-		_, err := NewClient([]string{"http://does.not.exist.local:9999/"}, "", "")
+		_, err := NewClient([]string{"http://does.not.exist.local:9999/"}, "", "", "")
 		if err == nil {
 			t.Error(err)
 			return
 		}
 	})
 	t.Run("Simple", func(t *testing.T) {
-		_, err := NewClient([]string{"http://localhost:9200"}, "", "")
+		_, err := NewClient([]string{"http://localhost:9200"}, "", "", "")
 		if err != nil {
 			t.Error(err)
 			return
@@ -154,7 +166,7 @@ func TestFindById(t *testing.T) {
 			return
 		}
 
-		doc, err := FindById(es, index, "1")
+		doc, err := FindById(es, index, "1", "", Fields{})
 		if err != nil {
 			t.Error(err)
 			return
@@ -173,7 +185,7 @@ func TestFindById(t *testing.T) {
 		}
 		t.Cleanup(CleanupIndex(t, es, index))
 
-		doc, err := FindById(es, index, "0")
+		doc, err := FindById(es, index, "0", "", Fields{})
 		if err != nil {
 			t.Error(err)
 			return
@@ -242,7 +254,7 @@ func TestLatestBySortFields(t *testing.T) {
 			"timestamp": "2020-05-10T00:00:00.000Z",
 		}
 
-		docs, err := LatestBySortFields(es, index, sortFields, doc)
+		docs, err := LatestBySortFields(es, index, sortFields, Filter{}, doc)
 		if err != nil {
 			t.Error(err)
 			return
@@ -272,7 +284,7 @@ func TestLatestBySortFields(t *testing.T) {
 			return
 		}
 
-		docs, err := LatestBySortFields(es, index, sortFields, nil)
+		docs, err := LatestBySortFields(es, index, sortFields, Filter{}, nil)
 		if err != nil {
 			t.Error(err)
 			return
@@ -321,7 +333,7 @@ func TestLatestBySortFields(t *testing.T) {
 			"timestamp": "2020-05-10T00:00:00.000Z",
 		}
 
-		docs, err := LatestBySortFields(es, index, sortFields, doc)
+		docs, err := LatestBySortFields(es, index, sortFields, Filter{}, doc)
 		if err != nil {
 			t.Error(err)
 			return
@@ -351,7 +363,7 @@ func TestLatestBySortFields(t *testing.T) {
 			return
 		}
 
-		docs, err := LatestBySortFields(es, index, sortFields, nil)
+		docs, err := LatestBySortFields(es, index, sortFields, Filter{}, nil)
 		if err != nil {
 			t.Error(err)
 			return
@@ -363,6 +375,457 @@ func TestLatestBySortFields(t *testing.T) {
 	})
 }
 
+func TestSinceBySortFields(t *testing.T) {
+	sortFields := []string{"timestamp"}
+	es := NewTestClient()
+
+	index, err := NewIndex(es, "since", nil)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, index))
+
+	for i := 0; i < 8; i++ {
+		// the last few share a timestamp
+		hour := i
+		if hour > 5 {
+			hour = 5
+		}
+		res, err := es.Create(index, strconv.Itoa(i), strings.NewReader(fmt.Sprintf(`{"timestamp": "2020-05-10T0%d:00:00.000Z"}`, hour)))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if res.IsError() {
+			t.Fatal(res.String())
+			return
+		}
+	}
+	err = RefreshIndex(es, index)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	t.Run("Everything", func(t *testing.T) {
+		docs, err := SinceBySortFields(es, index, sortFields, Filter{}, nil, "", 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 8 || docs[0].ID != "0" || docs[7].ID != "7" {
+			t.Errorf("Expected all documents in ascending order; got %v", docs)
+			return
+		}
+	})
+
+	t.Run("Cursor and limit", func(t *testing.T) {
+		cursor := &Cursor{
+			Values: map[string]interface{}{
+				"timestamp": "2020-05-10T02:00:00.000Z",
+			},
+		}
+		docs, err := SinceBySortFields(es, index, sortFields, Filter{}, cursor, "", 2)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 2 || docs[0].ID != "2" || docs[1].ID != "3" {
+			t.Errorf("Expected documents 2 and 3; got %v", docs)
+			return
+		}
+	})
+
+	t.Run("After documents one at a time", func(t *testing.T) {
+		// documents sharing a timestamp mustn't hold the cursor in place
+		cursor := &Cursor{
+			Values: map[string]interface{}{
+				"timestamp": "2020-05-10T04:00:00.000Z",
+			},
+			Id: "4",
+		}
+		var ids []string
+		for i := 0; i < 5; i++ {
+			docs, err := SinceBySortFields(es, index, sortFields, Filter{}, cursor, "", 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(docs) == 0 {
+				break
+			}
+			ids = append(ids, docs[0].ID)
+			values, err := hitValues(docs[0], sortFields)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			cursor = &Cursor{Values: values, Id: docs[0].ID}
+		}
+		if strings.Join(ids, ",") != "5,6,7" {
+			t.Errorf("Expected each later document once; got %v", ids)
+			return
+		}
+	})
+
+	t.Run("Collapse", func(t *testing.T) {
+		index, err := NewIndex(es, "collapse", map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"deployment": map[string]interface{}{"type": "keyword"},
+					"timestamp":  map[string]interface{}{"type": "date"},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		t.Cleanup(CleanupIndex(t, es, index))
+
+		for id, doc := range map[string]string{
+			"1": `{"deployment": "a", "timestamp": "2020-05-10T00:00:00.000Z"}`,
+			"2": `{"deployment": "b", "timestamp": "2020-05-10T01:00:00.000Z"}`,
+			"3": `{"deployment": "a", "timestamp": "2020-05-10T02:00:00.000Z"}`,
+			"4": `{"deployment": "c", "timestamp": "2020-05-10T03:00:00.000Z"}`,
+		} {
+			res, err := es.Create(index, id, strings.NewReader(doc))
+			if err != nil {
+				t.Fatal(err)
+				return
+			}
+			if res.IsError() {
+				t.Fatal(res.String())
+				return
+			}
+		}
+		err = RefreshIndex(es, index)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		docs, err := SinceBySortFields(es, index, sortFields, Filter{}, nil, "deployment", 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 3 || docs[0].ID != "2" || docs[1].ID != "3" || docs[2].ID != "4" {
+			t.Errorf("Expected the latest document per deployment in ascending order; got %v", docs)
+			return
+		}
+
+		// b's document precedes a's latest, so it can't be passed over by a limited check
+		docs, err = SinceBySortFields(es, index, sortFields, Filter{}, nil, "deployment", 1)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 1 || docs[0].ID != "1" {
+			t.Errorf("Expected only a's first document before b's; got %v", docs)
+			return
+		}
+	})
+}
+
+func TestSearchAll(t *testing.T) {
+	es := NewTestClient()
+
+	index, err := NewIndex(es, "search", nil)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, index))
+
+	create := func(id string, hour int) error {
+		res, err := es.Create(index, id, strings.NewReader(fmt.Sprintf(`{"timestamp": "2020-05-10T%02d:00:00.000Z"}`, hour)))
+		if err != nil {
+			return err
+		}
+		if res.IsError() {
+			return errors.New(res.String())
+		}
+		return nil
+	}
+	for i := 1; i <= 5; i++ {
+		if err := create(strconv.Itoa(i), i); err != nil {
+			t.Fatal(err)
+			return
+		}
+	}
+	err = RefreshIndex(es, index)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	pages := pageSize
+	t.Cleanup(func() {
+		pageSize = pages
+		testHookPage = func() {}
+	})
+	pageSize = 2
+
+	// documents indexed after the first page, both before and after the hits so far, mustn't be returned
+	searchMidCheck := func(es *Client, prefix string) ([]Hit, error) {
+		var err error
+		indexed := false
+		testHookPage = func() {
+			if indexed {
+				return
+			}
+			indexed = true
+			if err = create(prefix+"-before", 0); err != nil {
+				return
+			}
+			if err = create(prefix+"-after", 10); err != nil {
+				return
+			}
+			err = RefreshIndex(es, index)
+		}
+		query := map[string]interface{}{
+			"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+			"sort":  cursorSort(es, []string{"timestamp"}, "asc"),
+		}
+		hits, searchErr := searchAll(es, index, query, 0)
+		if searchErr != nil {
+			return nil, searchErr
+		}
+		return hits, err
+	}
+	expect := func(t *testing.T, hits []Hit) {
+		var ids []string
+		for _, hit := range hits {
+			ids = append(ids, hit.ID)
+		}
+		if strings.Join(ids, ",") != "1,2,3,4,5" {
+			t.Errorf("Expected the documents as of the first page; got %v", ids)
+		}
+	}
+
+	t.Run("Point in time", func(t *testing.T) {
+		if !es.Capabilities.PointInTime {
+			t.Skip("points in time aren't supported")
+		}
+		hits, err := searchMidCheck(es, "pit")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expect(t, hits)
+	})
+
+	t.Run("Scroll", func(t *testing.T) {
+		scrolling := *es
+		scrolling.Capabilities.PointInTime = false
+		hits, err := searchMidCheck(&scrolling, "scroll")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expect(t, hits)
+	})
+}
+
+func TestOrderClause(t *testing.T) {
+	clause, err := orderClause([]string{"timestamp", "name"}, map[string]interface{}{
+		"timestamp": "2020-05-10T00:00:00.000Z",
+		"name":      "a",
+	}, "gt")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	marshal, err := json.Marshal(clause)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := `{"bool":{"minimum_should_match":1,"should":[` +
+		`{"bool":{"filter":[{"range":{"timestamp":{"gt":"2020-05-10T00:00:00.000Z"}}}]}},` +
+		`{"bool":{"filter":[{"term":{"timestamp":"2020-05-10T00:00:00.000Z"}},{"range":{"name":{"gt":"a"}}}]}}]}}`
+	if string(marshal) != expected {
+		t.Errorf("Unexpected clause: %s", marshal)
+		return
+	}
+
+	_, err = orderClause([]string{"timestamp"}, map[string]interface{}{}, "gt")
+	if err == nil {
+		t.Error("Should be missing the timestamp")
+		return
+	}
+}
+
+func TestDedupeBySortFields(t *testing.T) {
+	sortFields := []string{"timestamp"}
+	settings := map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"deployment": map[string]interface{}{"type": "keyword"},
+				"timestamp":  map[string]interface{}{"type": "date"},
+			},
+		},
+	}
+	es := NewTestClient()
+
+	index, err := NewIndex(es, "dedupe", settings)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, index))
+
+	for id, doc := range map[string]string{
+		"1": `{"deployment": "a", "timestamp": "2020-05-10T00:00:00.000Z"}`,
+		"2": `{"deployment": "b", "timestamp": "2020-05-10T01:00:00.000Z"}`,
+		"3": `{"deployment": "a", "timestamp": "2020-05-10T02:00:00.000Z"}`,
+	} {
+		res, err := es.Create(index, id, strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if res.IsError() {
+			t.Fatal(res.String())
+			return
+		}
+	}
+	err = RefreshIndex(es, index)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	t.Run("Latest per value", func(t *testing.T) {
+		docs, err := DedupeBySortFields(es, index, sortFields, Filter{}, nil, "deployment", 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 2 || docs[0].ID != "2" || docs[1].ID != "3" {
+			t.Errorf("Expected the latest document per deployment in ascending order; got %v", docs)
+			return
+		}
+	})
+
+	t.Run("Paged", func(t *testing.T) {
+		pages := pageSize
+		t.Cleanup(func() {
+			pageSize = pages
+		})
+		// a value per page
+		pageSize = 1
+		docs, err := DedupeBySortFields(es, index, sortFields, Filter{}, nil, "deployment", 1)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 1 || docs[0].ID != "2" {
+			t.Errorf("Expected the earliest of every deployment's latest document; got %v", docs)
+			return
+		}
+	})
+}
+
+func TestLatestRevisions(t *testing.T) {
+	es := NewTestClient()
+
+	t.Run("Updated document", func(t *testing.T) {
+		index, err := NewIndex(es, "revisions", map[string]interface{}{
+			"settings": map[string]interface{}{
+				"number_of_shards": 1,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		t.Cleanup(CleanupIndex(t, es, index))
+
+		res, err := es.Index(index, strings.NewReader(`{"status": "running"}`), es.Index.WithDocumentID("1"), es.Index.WithRefresh("true"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if res.IsError() {
+			t.Error(res.String())
+			return
+		}
+
+		docs, err := LatestRevisions(es, index, "_seq_no", Filter{}, nil, "", 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 1 || docs[0].SeqNo == nil {
+			t.Errorf("Expected a single revision with a seq_no; got %v", docs)
+			return
+		}
+		cursor := *docs[0].SeqNo
+
+		res, err = es.Index(index, strings.NewReader(`{"status": "done"}`), es.Index.WithDocumentID("1"), es.Index.WithRefresh("true"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if res.IsError() {
+			t.Error(res.String())
+			return
+		}
+
+		docs, err = LatestRevisions(es, index, "_seq_no", Filter{}, &Cursor{Values: map[string]interface{}{"_seq_no": cursor}, Id: "1"}, "", 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 1 || *docs[0].SeqNo <= cursor {
+			t.Errorf("Expected the updated revision; got %v", docs)
+			return
+		}
+	})
+
+	t.Run("Multiple shards", func(t *testing.T) {
+		index, err := NewIndex(es, "revisions", map[string]interface{}{
+			"settings": map[string]interface{}{
+				"number_of_shards": 2,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		t.Cleanup(CleanupIndex(t, es, index))
+
+		// _seq_no isn't ordered across shards
+		_, err = LatestRevisions(es, index, "_seq_no", Filter{}, nil, "", 0)
+		if err == nil {
+			t.Error("Should refuse to track _seq_no across shards")
+			return
+		}
+
+		res, err := es.Index(index, strings.NewReader(`{"status": "running", "updated_at": 1}`), es.Index.WithDocumentID("1"), es.Index.WithRefresh("true"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if res.IsError() {
+			t.Error(res.String())
+			return
+		}
+		docs, err := LatestRevisions(es, index, "updated_at", Filter{}, nil, "", 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 1 {
+			t.Errorf("Expected the document's revision by updated_at; got %v", docs)
+			return
+		}
+	})
+}
+
 func TestCreateIndex(t *testing.T) {
 	fieldMap := map[string]PropertyMapping{
 		"timestamp": {
@@ -440,3 +903,40 @@ func TestCreateIndex(t *testing.T) {
 		}
 	})
 }
+
+func TestCompareSort(t *testing.T) {
+	raw := func(values ...string) []json.RawMessage {
+		var sortValues []json.RawMessage
+		for _, value := range values {
+			sortValues = append(sortValues, json.RawMessage(value))
+		}
+		return sortValues
+	}
+
+	if compareSort(raw("9"), raw("10")) >= 0 {
+		t.Error("Numbers should compare numerically")
+		return
+	}
+	if compareSort(raw(`"b"`), raw(`"a"`)) <= 0 {
+		t.Error("Strings should compare lexically")
+		return
+	}
+	if compareSort(raw("1", `"a"`), raw("1", `"a"`)) != 0 {
+		t.Error("Equal sort values should compare equal")
+		return
+	}
+}
+
+func TestIsRemote(t *testing.T) {
+	for index, remote := range map[string]bool{
+		"events":                 false,
+		"events-*":               false,
+		"remote:events-*":        true,
+		"events,remote:events-*": true,
+	} {
+		if IsRemote(index) != remote {
+			t.Errorf("Expected IsRemote(%s) to be %t", index, remote)
+			return
+		}
+	}
+}
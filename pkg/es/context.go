@@ -0,0 +1,167 @@
+package es
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// contextDocument fetches the document around which context is taken, along with its sort values.
+func contextDocument(client *Client, index string, sortFields []string, id string) (*Hit, error) {
+	envelope, err := search(client, index, map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{
+				"values": []string{id},
+			},
+		},
+		"sort": cursorSort(client, sortFields, "asc"),
+		"size": 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Hits.Hits) == 0 {
+		return nil, fmt.Errorf("document (%s) doesn't exist in index (%s)", id, index)
+	}
+	return &envelope.Hits.Hits[0], nil
+}
+
+// Context returns the document along with up to before/after of its neighbours by sort order, in ascending order.
+func Context(client *Client, index string, sortFields []string, filter Filter, id string, before int, after int) ([]Hit, error) {
+	if len(sortFields) == 0 {
+		return nil, fmt.Errorf("must have at least one sorted field")
+	}
+
+	document, err := contextDocument(client, index, sortFields, id)
+	if err != nil {
+		return nil, err
+	}
+
+	neighbours := func(order string, size int) ([]Hit, error) {
+		if size == 0 {
+			return nil, nil
+		}
+		envelope, err := search(client, index, map[string]interface{}{
+			"query": filter.apply(map[string]interface{}{
+				"match_all": map[string]interface{}{},
+			}),
+			"sort":         cursorSort(client, sortFields, order),
+			"search_after": document.Sort,
+			"size":         size,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return envelope.Hits.Hits, nil
+	}
+
+	preceding, err := neighbours("desc", before)
+	if err != nil {
+		return nil, err
+	}
+	following, err := neighbours("asc", after)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(preceding)+1+len(following))
+	for i := len(preceding) - 1; i >= 0; i-- {
+		hits = append(hits, preceding[i])
+	}
+	hits = append(hits, *document)
+	return append(hits, following...), nil
+}
+
+// ContextWindow returns the documents whose first sort field is within window either side of the document's, in
+// ascending order. The field must be a date.
+// At most limit documents, including the document itself, are returned, split evenly either side of it where there
+// are enough, and reported as truncated if any within the window were left out.
+func ContextWindow(client *Client, index string, sortFields []string, filter Filter, id string, window time.Duration, limit int) ([]Hit, bool, error) {
+	if len(sortFields) == 0 {
+		return nil, false, fmt.Errorf("must have at least one sorted field")
+	}
+	if limit < 1 {
+		return nil, false, fmt.Errorf("context limit must be at least 1")
+	}
+
+	document, err := contextDocument(client, index, sortFields, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var source map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(document.Source))
+	decoder.UseNumber()
+	if err := decoder.Decode(&source); err != nil {
+		return nil, false, err
+	}
+	at, ok := FieldValue(source, sortFields[0])
+	if !ok {
+		return nil, false, fmt.Errorf("sort field, %s, missing from document (%s)", sortFields[0], id)
+	}
+
+	// date math has no sub-second unit
+	seconds := int64(window / time.Second)
+	// up to the limit either side, so either can make up for the other falling short, plus one to tell if any were left out
+	remaining := limit - 1
+	preceding, err := nearestHits(client, index, sortFields, filter, id, map[string]interface{}{
+		"gte": fmt.Sprintf("%v||-%ds", at, seconds),
+		"lte": at,
+	}, "desc", remaining+1)
+	if err != nil {
+		return nil, false, err
+	}
+	following, err := nearestHits(client, index, sortFields, filter, id, map[string]interface{}{
+		"gt":  at,
+		"lte": fmt.Sprintf("%v||+%ds", at, seconds),
+	}, "asc", remaining+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	before := remaining / 2
+	if remaining-len(following) > before {
+		before = remaining - len(following)
+	}
+	if len(preceding) < before {
+		before = len(preceding)
+	}
+	after := remaining - before
+	if len(following) < after {
+		after = len(following)
+	}
+	truncated := len(preceding) > before || len(following) > after
+	preceding, following = preceding[:before], following[:after]
+
+	hits := append(append(preceding, *document), following...)
+	// documents sharing the document's first sort field may sort after it
+	sort.SliceStable(hits, func(i, j int) bool {
+		return compareSort(hits[i].Sort, hits[j].Sort) < 0
+	})
+	return hits, truncated, nil
+}
+
+// nearestHits searches for the documents, other than the one with the ID, whose first sort field is within the
+// bounds, ordered by the sort fields.
+func nearestHits(client *Client, index string, sortFields []string, filter Filter, id string, bounds map[string]interface{}, order string, limit int) ([]Hit, error) {
+	query := map[string]interface{}{
+		"query": filter.apply(map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"range": map[string]interface{}{
+						sortFields[0]: bounds,
+					},
+				},
+				"must_not": map[string]interface{}{
+					"ids": map[string]interface{}{
+						"values": []string{id},
+					},
+				},
+			},
+		}),
+		"sort": cursorSort(client, sortFields, order),
+	}
+	return searchAll(client, index, query, limit)
+}
@@ -0,0 +1,105 @@
+package es
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContext(t *testing.T) {
+	sortFields := []string{"timestamp"}
+	es := NewTestClient()
+
+	index, err := NewIndex(es, "context", nil)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, index))
+
+	for i := 0; i < 6; i++ {
+		res, err := es.Create(index, strconv.Itoa(i), strings.NewReader(fmt.Sprintf(`{"timestamp": "2020-05-10T0%d:00:00.000Z"}`, i)))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if res.IsError() {
+			t.Fatal(res.String())
+			return
+		}
+	}
+	err = RefreshIndex(es, index)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	t.Run("Before and after", func(t *testing.T) {
+		docs, err := Context(es, index, sortFields, Filter{}, "2", 1, 2)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 4 || docs[0].ID != "1" || docs[1].ID != "2" || docs[3].ID != "4" {
+			t.Errorf("Expected documents 1 through 4; got %v", docs)
+			return
+		}
+	})
+
+	t.Run("Edges", func(t *testing.T) {
+		docs, err := Context(es, index, sortFields, Filter{}, "0", 3, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 1 || docs[0].ID != "0" {
+			t.Errorf("Expected only document 0; got %v", docs)
+			return
+		}
+	})
+
+	t.Run("Window", func(t *testing.T) {
+		docs, truncated, err := ContextWindow(es, index, sortFields, Filter{}, "3", 90*time.Minute, 10)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 3 || docs[0].ID != "2" || docs[2].ID != "4" || truncated {
+			t.Errorf("Expected documents 2 through 4; got %v", docs)
+			return
+		}
+	})
+
+	t.Run("Window limit", func(t *testing.T) {
+		docs, truncated, err := ContextWindow(es, index, sortFields, Filter{}, "3", 3*time.Hour, 3)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 3 || docs[0].ID != "2" || docs[2].ID != "4" || !truncated {
+			t.Errorf("Expected documents 2 through 4, truncated; got %v", docs)
+			return
+		}
+
+		// the window ends at document 5, so the rest is made up from before the document
+		docs, truncated, err = ContextWindow(es, index, sortFields, Filter{}, "5", 3*time.Hour, 3)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 3 || docs[0].ID != "3" || docs[2].ID != "5" || !truncated {
+			t.Errorf("Expected documents 3 through 5, truncated; got %v", docs)
+			return
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := Context(es, index, sortFields, Filter{}, "missing", 1, 1)
+		if err == nil {
+			t.Error("Expected an error for a missing document")
+			return
+		}
+	})
+}
@@ -0,0 +1,255 @@
+package es
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Cursor is a position in the sort order to search from: the values of the sort fields there and, for the position
+// of a document, its ID, so documents sharing all its sort values can be told apart by their _id.
+type Cursor struct {
+	Values map[string]interface{}
+	Id     string
+}
+
+// cursorSort orders by the sort fields, tie-broken by _id where the cluster can sort on it.
+func cursorSort(client *Client, sortFields []string, order string) []map[string]interface{} {
+	var sortProcessor []map[string]interface{}
+	for _, field := range sortFields {
+		sortProcessor = append(sortProcessor, map[string]interface{}{
+			field: order,
+		})
+	}
+	if client.Capabilities.IdSort {
+		sortProcessor = append(sortProcessor, map[string]interface{}{
+			"_id": order,
+		})
+	}
+	return sortProcessor
+}
+
+// hitValues looks up the hit's values of the sort fields, taking _seq_no from its metadata.
+func hitValues(hit Hit, sortFields []string) (map[string]interface{}, error) {
+	var source map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(hit.Source))
+	// preserve numbers as-is for use in queries
+	decoder.UseNumber()
+	if err := decoder.Decode(&source); err != nil {
+		return nil, fmt.Errorf(err.Error())
+	}
+
+	values := map[string]interface{}{}
+	for _, field := range sortFields {
+		if field == "_seq_no" && hit.SeqNo != nil {
+			values[field] = *hit.SeqNo
+			continue
+		}
+		value, ok := FieldValue(source, field)
+		if !ok {
+			return nil, fmt.Errorf("field not found in doc: %s", field)
+		}
+		values[field] = value
+	}
+	return values, nil
+}
+
+// tieClauses match documents whose sort fields all equal the values.
+func tieClauses(sortFields []string, values map[string]interface{}) ([]interface{}, error) {
+	var terms []interface{}
+	for _, field := range sortFields {
+		value, ok := FieldValue(values, field)
+		if !ok {
+			return nil, fmt.Errorf("field not found in doc: %s", field)
+		}
+		terms = append(terms, map[string]interface{}{
+			"term": map[string]interface{}{
+				field: value,
+			},
+		})
+	}
+	return terms, nil
+}
+
+// orderClause matches documents sorted strictly before (lt) or after (gt) the values, comparing the sort fields in
+// order as the sort does.
+func orderClause(sortFields []string, values map[string]interface{}, op string) (map[string]interface{}, error) {
+	terms, err := tieClauses(sortFields, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var should []interface{}
+	for i, field := range sortFields {
+		value, _ := FieldValue(values, field)
+		filters := append([]interface{}{}, terms[:i]...)
+		should = append(should, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": append(filters, map[string]interface{}{
+					"range": map[string]interface{}{
+						field: map[string]interface{}{
+							op: value,
+						},
+					},
+				}),
+			},
+		})
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               should,
+			"minimum_should_match": 1,
+		},
+	}, nil
+}
+
+// tiedBefore lists the IDs of the documents tied with the cursor's on every sort field which precede it by _id,
+// which were returned along with or before it.
+func tiedBefore(client *Client, index string, sortFields []string, cursor *Cursor) ([]string, error) {
+	terms, err := tieClauses(sortFields, cursor.Values)
+	if err != nil {
+		return nil, err
+	}
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": terms,
+			},
+		},
+		"_source": false,
+		"sort": []map[string]interface{}{
+			{sortFields[0]: "asc"},
+		},
+	}
+	hits, err := searchAll(client, index, query, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{cursor.Id}
+	for _, hit := range hits {
+		if hit.ID < cursor.Id {
+			ids = append(ids, hit.ID)
+		}
+	}
+	return ids, nil
+}
+
+// cursorClause matches the documents from the cursor on in the sort order. A nil cursor matches every document.
+// Without an ID, documents tied with the cursor on every sort field are included;
+// with one, only those whose _id follows it are, so a document's cursor continues after it.
+func cursorClause(client *Client, index string, sortFields []string, cursor *Cursor) (map[string]interface{}, error) {
+	if cursor == nil {
+		return map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		}, nil
+	}
+
+	after, err := orderClause(sortFields, cursor.Values, "gt")
+	if err != nil {
+		return nil, err
+	}
+	terms, err := tieClauses(sortFields, cursor.Values)
+	if err != nil {
+		return nil, err
+	}
+	ties := map[string]interface{}{
+		"filter": terms,
+	}
+	if cursor.Id != "" {
+		before, err := tiedBefore(client, index, sortFields, cursor)
+		if err != nil {
+			return nil, err
+		}
+		ties["must_not"] = map[string]interface{}{
+			"ids": map[string]interface{}{
+				"values": before,
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []interface{}{
+				after,
+				map[string]interface{}{
+					"bool": ties,
+				},
+			},
+			"minimum_should_match": 1,
+		},
+	}, nil
+}
+
+// collapseLatest returns the latest document for each distinct value of the field among those matching the clause,
+// in ascending order, stopping at the limit if non-zero. Documents without the field are collapsed together.
+// Collapsing can't be combined with search_after, so rather than paging, the documents considered stop short of the
+// first document of the value past the limit so that values beyond it are all still after the last document returned.
+func collapseLatest(client *Client, index string, sortFields []string, clause map[string]interface{}, field string, limit int, options map[string]interface{}) ([]Hit, error) {
+	size := limit
+	if size == 0 || size >= maxBuckets {
+		size = maxBuckets - 1
+	}
+	collapsed := func(clause map[string]interface{}) ([]Hit, error) {
+		latest := map[string]interface{}{
+			"name": "latest",
+			"size": 1,
+			"sort": cursorSort(client, sortFields, "desc"),
+		}
+		query := map[string]interface{}{
+			"query": clause,
+			"sort":  cursorSort(client, sortFields, "asc"),
+			// one more than needed to tell if there are values past the limit
+			"size": size + 1,
+			"collapse": map[string]interface{}{
+				"field":      field,
+				"inner_hits": latest,
+			},
+		}
+		for key, value := range options {
+			query[key] = value
+			latest[key] = value
+		}
+		envelope, err := search(client, index, query)
+		if err != nil {
+			return nil, err
+		}
+		return envelope.Hits.Hits, nil
+	}
+
+	groups, err := collapsed(clause)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) > size {
+		values, err := hitValues(groups[size], sortFields)
+		if err != nil {
+			return nil, err
+		}
+		before, err := orderClause(sortFields, values, "lt")
+		if err != nil {
+			return nil, err
+		}
+		groups, err = collapsed(map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{clause, before},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(groups) > size {
+			groups = groups[:size]
+		}
+	}
+
+	var hits []Hit
+	for _, group := range groups {
+		hits = append(hits, group.InnerHits["latest"].Hits.Hits...)
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return compareSort(hits[i].Sort, hits[j].Sort) < 0
+	})
+	return hits, nil
+}
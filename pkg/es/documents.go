@@ -0,0 +1,191 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"log"
+)
+
+// CreateDocument indexes the document under the ID, through the ingest pipeline and with the routing if given,
+// returning the write's response, or nil if a document with the ID already exists, in which case it's left as-is.
+func CreateDocument(client *Client, index string, id string, document []byte, routing string, pipeline string, refresh string, waitForActiveShards string) (*WriteResponse, error) {
+	opts := []func(*esapi.CreateRequest){
+		client.Create.WithContext(context.Background()),
+	}
+	if !client.Capabilities.Typeless {
+		opts = append(opts, client.Create.WithDocumentType("_doc"))
+	}
+	if refresh != "" {
+		opts = append(opts, client.Create.WithRefresh(refresh))
+	}
+	if waitForActiveShards != "" {
+		opts = append(opts, client.Create.WithWaitForActiveShards(waitForActiveShards))
+	}
+	if pipeline != "" {
+		opts = append(opts, client.Create.WithPipeline(pipeline))
+	}
+	if routing != "" {
+		opts = append(opts, client.Create.WithRouting(routing))
+	}
+	res, err := client.Create(index, id, bytes.NewReader(document), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating document: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 409 {
+		return nil, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("error creating document: %s", res.String())
+	}
+
+	var written WriteResponse
+	if err := json.NewDecoder(res.Body).Decode(&written); err != nil {
+		return nil, fmt.Errorf(err.Error())
+	}
+	return &written, nil
+}
+
+// DeleteById deletes a single document, returning false if it was already gone.
+func DeleteById(client *Client, index string, id string, routing string, refresh string) (bool, error) {
+	opts := []func(*esapi.DeleteRequest){
+		client.Delete.WithContext(context.Background()),
+	}
+	if !client.Capabilities.Typeless {
+		opts = append(opts, client.Delete.WithDocumentType("_doc"))
+	}
+	if routing != "" {
+		opts = append(opts, client.Delete.WithRouting(routing))
+	}
+	if refresh != "" {
+		opts = append(opts, client.Delete.WithRefresh(refresh))
+	}
+	res, err := client.Delete(index, id, opts...)
+	if err != nil {
+		return false, fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return false, nil
+	}
+	if res.IsError() {
+		return false, errors.New(res.String())
+	}
+	return true, nil
+}
+
+// DeleteByQuery deletes every document matching the query clause, returning the number deleted.
+func DeleteByQuery(client *Client, index string, query map[string]interface{}, refresh bool) (int, error) {
+	body, err := encodeQuery(query)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Deleting by query, %s", body.String())
+	res, err := client.DeleteByQuery(
+		[]string{index},
+		body,
+		client.DeleteByQuery.WithContext(context.Background()),
+		client.DeleteByQuery.WithRefresh(refresh),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error getting response: %s", err)
+	}
+	byQuery, err := decodeByQuery(res)
+	if err != nil {
+		return 0, err
+	}
+	return byQuery.Deleted, nil
+}
+
+// TombstoneById sets the tombstone field on a single document.
+func TombstoneById(client *Client, index string, id string, routing string, field string, refresh string) error {
+	marshal, err := json.Marshal(map[string]interface{}{
+		"doc": map[string]interface{}{
+			field: true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	opts := []func(*esapi.UpdateRequest){
+		client.Update.WithContext(context.Background()),
+	}
+	if !client.Capabilities.Typeless {
+		opts = append(opts, client.Update.WithDocumentType("_doc"))
+	}
+	if routing != "" {
+		opts = append(opts, client.Update.WithRouting(routing))
+	}
+	if refresh != "" {
+		opts = append(opts, client.Update.WithRefresh(refresh))
+	}
+	res, err := client.Update(index, id, bytes.NewReader(marshal), opts...)
+	if err != nil {
+		return fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+	return nil
+}
+
+// TombstoneByQuery sets the tombstone field on every document matching the query clause, returning the number updated.
+func TombstoneByQuery(client *Client, index string, query map[string]interface{}, field string, refresh bool) (int, error) {
+	body := map[string]interface{}{
+		"query": query,
+		"script": map[string]interface{}{
+			"source": "ctx._source[params.field] = true",
+			"lang":   "painless",
+			"params": map[string]interface{}{
+				"field": field,
+			},
+		},
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return 0, fmt.Errorf("error encoding query: %s", err)
+	}
+	log.Printf("Tombstoning by query, %s", buf.String())
+	res, err := client.UpdateByQuery(
+		[]string{index},
+		client.UpdateByQuery.WithContext(context.Background()),
+		client.UpdateByQuery.WithBody(&buf),
+		client.UpdateByQuery.WithRefresh(refresh),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error getting response: %s", err)
+	}
+	byQuery, err := decodeByQuery(res)
+	if err != nil {
+		return 0, err
+	}
+	return byQuery.Updated, nil
+}
+
+func encodeQuery(query map[string]interface{}) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"query": query}); err != nil {
+		return nil, fmt.Errorf("error encoding query: %s", err)
+	}
+	return &buf, nil
+}
+
+func decodeByQuery(res *esapi.Response) (*ByQueryResponse, error) {
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+	var byQuery ByQueryResponse
+	if err := json.NewDecoder(res.Body).Decode(&byQuery); err != nil {
+		return nil, fmt.Errorf(err.Error())
+	}
+	if len(byQuery.Failures) > 0 {
+		return nil, fmt.Errorf("%d failures; first failure: %s", len(byQuery.Failures), byQuery.Failures[0])
+	}
+	return &byQuery, nil
+}
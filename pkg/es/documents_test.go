@@ -0,0 +1,204 @@
+package es
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCreateDocument(t *testing.T) {
+	es := NewTestClient()
+
+	settings := map[string]interface{}{
+		"settings": map[string]interface{}{
+			"number_of_shards": 2,
+		},
+	}
+	index, err := NewIndex(es, "createdocument", settings)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, index))
+
+	pipeline := NewIndexName("createdocument")
+	res, err := es.Ingest.PutPipeline(pipeline, strings.NewReader(`{"processors":[{"set":{"field":"ingested","value":true}}]}`))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if res.IsError() {
+		t.Fatal(errors.New(res.String()))
+		return
+	}
+	t.Cleanup(func() {
+		res, err := es.Ingest.DeletePipeline(pipeline)
+		if err != nil {
+			t.Log(err)
+			return
+		}
+		if res.IsError() {
+			t.Log(res.String())
+		}
+	})
+
+	t.Run("Pipeline and routing", func(t *testing.T) {
+		written, err := CreateDocument(es, index, "1", []byte(`{"name":"a"}`), "tenant-a", pipeline, "true", "")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if written == nil || written.ID != "1" {
+			t.Errorf("Expected the document to be created; got %v", written)
+			return
+		}
+
+		hit, err := FindHitById(es, index, "1", "tenant-a", Fields{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if hit == nil || hit.Routing != "tenant-a" {
+			t.Errorf("Expected the document routed by tenant-a; got %v", hit)
+			return
+		}
+		var document map[string]interface{}
+		if err := json.Unmarshal(hit.Source, &document); err != nil {
+			t.Error(err)
+			return
+		}
+		if document["name"] != "a" || document["ingested"] != true {
+			t.Errorf("Expected the document as run through the pipeline; got %v", document)
+			return
+		}
+	})
+
+	t.Run("Already exists", func(t *testing.T) {
+		written, err := CreateDocument(es, index, "1", []byte(`{"name":"b"}`), "tenant-a", "", "true", "")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if written != nil {
+			t.Errorf("Expected the existing document to be left as-is; got %v", written)
+			return
+		}
+	})
+}
+
+func TestDeleteById(t *testing.T) {
+	es := NewTestClient()
+
+	index, err := NewIndex(es, "deletebyid", nil)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, index))
+
+	_, err = es.Create(index, "1", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	t.Run("Existing document", func(t *testing.T) {
+		found, err := DeleteById(es, index, "1", "", "true")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !found {
+			t.Error("Document should have been deleted")
+			return
+		}
+	})
+
+	t.Run("Missing document", func(t *testing.T) {
+		found, err := DeleteById(es, index, "1", "", "true")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if found {
+			t.Error("Document should already be gone")
+			return
+		}
+	})
+}
+
+func TestTombstone(t *testing.T) {
+	sortFields := []string{"timestamp"}
+	es := NewTestClient()
+
+	index, err := NewIndex(es, "tombstone", nil)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, index))
+
+	for id, doc := range map[string]string{
+		"1": `{"timestamp": "2020-05-10T00:00:00.000Z", "status": "bad"}`,
+		"2": `{"timestamp": "2020-05-10T01:00:00.000Z", "status": "bad"}`,
+		"3": `{"timestamp": "2020-05-10T02:00:00.000Z", "status": "good"}`,
+	} {
+		res, err := es.Create(index, id, strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if res.IsError() {
+			t.Fatal(res.String())
+			return
+		}
+	}
+	err = RefreshIndex(es, index)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	t.Run("By id", func(t *testing.T) {
+		err := TombstoneById(es, index, "3", "", "retracted", "true")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		docs, err := LatestBySortFields(es, index, sortFields, Filter{TombstoneField: "retracted"}, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 1 || docs[0].ID != "2" {
+			t.Errorf("Expected the latest live document to be 2; got %v", docs)
+			return
+		}
+	})
+
+	t.Run("By query", func(t *testing.T) {
+		updated, err := TombstoneByQuery(es, index, map[string]interface{}{
+			"term": map[string]interface{}{
+				"status.keyword": "bad",
+			},
+		}, "retracted", true)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if updated != 2 {
+			t.Errorf("Expected 2 documents tombstoned; got %d", updated)
+			return
+		}
+		docs, err := LatestBySortFields(es, index, sortFields, Filter{TombstoneField: "retracted"}, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(docs) != 0 {
+			t.Errorf("No documents should be returned; got %d", len(docs))
+			return
+		}
+	})
+}
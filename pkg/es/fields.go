@@ -0,0 +1,40 @@
+package es
+
+// Fields selects which parts of a document are fetched.
+type Fields struct {
+	// Includes and Excludes filter the _source by (wildcard) field paths
+	Includes []string
+	Excludes []string
+	// DocvalueFields and StoredFields are returned alongside the _source under the hit's fields
+	DocvalueFields []string
+	StoredFields   []string
+	// NoSource fetches only the hit's metadata, e.g. to check a document exists
+	NoSource bool
+}
+
+// apply adds the selection to the search body.
+func (f Fields) apply(query map[string]interface{}) {
+	if f.NoSource {
+		query["_source"] = false
+		return
+	}
+	if len(f.Includes) > 0 || len(f.Excludes) > 0 {
+		source := map[string]interface{}{}
+		if len(f.Includes) > 0 {
+			source["includes"] = f.Includes
+		}
+		if len(f.Excludes) > 0 {
+			source["excludes"] = f.Excludes
+		}
+		query["_source"] = source
+	} else if len(f.StoredFields) > 0 {
+		// requesting stored fields otherwise drops the _source
+		query["_source"] = true
+	}
+	if len(f.DocvalueFields) > 0 {
+		query["docvalue_fields"] = f.DocvalueFields
+	}
+	if len(f.StoredFields) > 0 {
+		query["stored_fields"] = f.StoredFields
+	}
+}
@@ -0,0 +1,50 @@
+package es
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFieldsApply(t *testing.T) {
+	t.Run("Empty fields", func(t *testing.T) {
+		query := map[string]interface{}{}
+		Fields{}.apply(query)
+		if len(query) != 0 {
+			t.Errorf("Query should be untouched; got %v", query)
+			return
+		}
+	})
+
+	t.Run("Source filtering", func(t *testing.T) {
+		query := map[string]interface{}{}
+		Fields{Excludes: []string{"payload"}, DocvalueFields: []string{"timestamp"}}.apply(query)
+		marshal, err := json.Marshal(query)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expected := `{"_source":{"excludes":["payload"]},"docvalue_fields":["timestamp"]}`
+		if string(marshal) != expected {
+			t.Errorf("Expected %s; got %s", expected, marshal)
+			return
+		}
+	})
+
+	t.Run("No source", func(t *testing.T) {
+		query := map[string]interface{}{}
+		Fields{NoSource: true, DocvalueFields: []string{"timestamp"}}.apply(query)
+		if len(query) != 1 || query["_source"] != false {
+			t.Errorf("Only the source should be disabled; got %v", query)
+			return
+		}
+	})
+
+	t.Run("Stored fields keep the source", func(t *testing.T) {
+		query := map[string]interface{}{}
+		Fields{StoredFields: []string{"title"}}.apply(query)
+		if query["_source"] != true {
+			t.Errorf("Source should be requested; got %v", query)
+			return
+		}
+	})
+}
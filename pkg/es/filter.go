@@ -0,0 +1,40 @@
+package es
+
+// Filter narrows the documents considered when searching for versions.
+type Filter struct {
+	// Query is a query clause documents must match, e.g. {"term": {"level": "error"}}
+	Query map[string]interface{}
+	// TombstoneField excludes soft-deleted documents having this field
+	TombstoneField string
+}
+
+// apply combines the filter with the given query clause.
+func (f Filter) apply(query map[string]interface{}) map[string]interface{} {
+	if f.Query == nil && f.TombstoneField == "" {
+		return query
+	}
+	filters := []interface{}{query}
+	if f.Query != nil {
+		filters = append(filters, f.Query)
+	}
+	boolQuery := map[string]interface{}{
+		"filter": filters,
+	}
+	if f.TombstoneField != "" {
+		boolQuery["must_not"] = map[string]interface{}{
+			"exists": map[string]interface{}{
+				"field": f.TombstoneField,
+			},
+		}
+	}
+	return map[string]interface{}{
+		"bool": boolQuery,
+	}
+}
+
+// Clause is a query clause matching every document the filter allows.
+func (f Filter) Clause() map[string]interface{} {
+	return f.apply(map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	})
+}
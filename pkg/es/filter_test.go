@@ -0,0 +1,39 @@
+package es
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFilterApply(t *testing.T) {
+	matchAll := map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	}
+
+	t.Run("Empty filter", func(t *testing.T) {
+		query := Filter{}.apply(matchAll)
+		if _, ok := query["match_all"]; !ok {
+			t.Errorf("Query should be untouched; got %v", query)
+			return
+		}
+	})
+
+	t.Run("Query and tombstone", func(t *testing.T) {
+		query := Filter{
+			Query: map[string]interface{}{
+				"term": map[string]interface{}{"level": "error"},
+			},
+			TombstoneField: "retracted",
+		}.apply(matchAll)
+		marshal, err := json.Marshal(query)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expected := `{"bool":{"filter":[{"match_all":{}},{"term":{"level":"error"}}],"must_not":{"exists":{"field":"retracted"}}}}`
+		if string(marshal) != expected {
+			t.Errorf("Expected %s; got %s", expected, marshal)
+			return
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"time"
+)
+
+// Health statuses, from least to most healthy.
+const (
+	HealthRed    = "red"
+	HealthYellow = "yellow"
+	HealthGreen  = "green"
+)
+
+var healthRanks = map[string]int{
+	HealthRed:    1,
+	HealthYellow: 2,
+	HealthGreen:  3,
+}
+
+// ValidHealth reports whether the status is one of red, yellow or green.
+func ValidHealth(status string) bool {
+	_, ok := healthRanks[status]
+	return ok
+}
+
+// HealthAtLeast reports whether the status is at least as healthy as the required one.
+func HealthAtLeast(status string, required string) bool {
+	return healthRanks[status] >= healthRanks[required]
+}
+
+type ClusterHealth struct {
+	ClusterName         string `json:"cluster_name"`
+	Status              string `json:"status"`
+	TimedOut            bool   `json:"timed_out"`
+	NumberOfNodes       int    `json:"number_of_nodes"`
+	ActivePrimaryShards int    `json:"active_primary_shards"`
+	ActiveShards        int    `json:"active_shards"`
+	RelocatingShards    int    `json:"relocating_shards"`
+	InitializingShards  int    `json:"initializing_shards"`
+	UnassignedShards    int    `json:"unassigned_shards"`
+}
+
+// Health returns the cluster's health, or the index's if given.
+// If a status is given, it waits up to the timeout for at least that status, reporting whether it timed out.
+func Health(client *Client, index string, waitFor string, timeout time.Duration) (*ClusterHealth, error) {
+	api := client.Cluster.Health
+	opts := []func(*esapi.ClusterHealthRequest){
+		api.WithContext(context.Background()),
+	}
+	if index != "" {
+		opts = append(opts, api.WithIndex(index))
+	}
+	if waitFor != "" {
+		opts = append(opts, api.WithWaitForStatus(waitFor), api.WithTimeout(timeout))
+	}
+	res, err := api(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	// timing out waiting for a status still reports the health
+	if res.IsError() && res.StatusCode != 408 {
+		return nil, errors.New(res.String())
+	}
+	var health ClusterHealth
+	if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+		return nil, fmt.Errorf(err.Error())
+	}
+	return &health, nil
+}
@@ -0,0 +1,71 @@
+package es
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthAtLeast(t *testing.T) {
+	if !HealthAtLeast(HealthGreen, HealthYellow) || !HealthAtLeast(HealthYellow, HealthYellow) {
+		t.Error("Expected green and yellow to be at least yellow")
+		return
+	}
+	if HealthAtLeast(HealthRed, HealthYellow) || HealthAtLeast("", HealthRed) {
+		t.Error("Expected red and unknown statuses not to be at least yellow")
+		return
+	}
+	if ValidHealth("blue") {
+		t.Error("Expected blue to be invalid")
+		return
+	}
+}
+
+func TestHealth(t *testing.T) {
+	es := NewTestClient()
+
+	// replicas can't be allocated on a single node, so the index stays yellow
+	index, err := NewIndex(es, "health", map[string]interface{}{
+		"settings": map[string]interface{}{"number_of_replicas": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, index))
+
+	t.Run("Cluster", func(t *testing.T) {
+		health, err := Health(es, "", "", 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !ValidHealth(health.Status) || health.ClusterName == "" {
+			t.Errorf("Expected the cluster's health; got %v", health)
+			return
+		}
+	})
+
+	t.Run("Wait for status", func(t *testing.T) {
+		health, err := Health(es, index, HealthYellow, 5*time.Second)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if health.TimedOut || health.Status != HealthYellow {
+			t.Errorf("Expected a yellow index; got %v", health)
+			return
+		}
+	})
+
+	t.Run("Time out", func(t *testing.T) {
+		health, err := Health(es, index, HealthGreen, time.Second)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !health.TimedOut {
+			t.Errorf("Expected to time out waiting for green; got %v", health)
+			return
+		}
+	})
+}
@@ -0,0 +1,390 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// taskPollInterval is how often a running task's status is checked.
+var taskPollInterval = 5 * time.Second
+
+type TaskResponse struct {
+	Completed bool             `json:"completed"`
+	Response  *ByQueryResponse `json:"response,omitempty"`
+	Error     json.RawMessage  `json:"error,omitempty"`
+}
+
+type CountResponse struct {
+	Count int `json:"count"`
+}
+
+// Reindex copies every document of the source index into the destination, keeping their IDs, and waits up to the
+// timeout, if non-zero, for it to finish. The number of documents created or updated is returned.
+func Reindex(client *Client, source string, dest string, timeout time.Duration) (int, error) {
+	marshal, err := json.Marshal(map[string]interface{}{
+		"source": map[string]interface{}{
+			"index": source,
+		},
+		"dest": map[string]interface{}{
+			"index": dest,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	res, err := client.Reindex(
+		bytes.NewReader(marshal),
+		client.Reindex.WithContext(context.Background()),
+		// large indices outlive a request, so the reindex runs as a task
+		client.Reindex.WithWaitForCompletion(false),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return 0, errors.New(res.String())
+	}
+	var started struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&started); err != nil {
+		return 0, fmt.Errorf(err.Error())
+	}
+
+	log.Printf("Reindexing %s into %s as task %s", source, dest, started.Task)
+	response, err := WaitForTask(client, started.Task, timeout)
+	if err != nil {
+		return 0, err
+	}
+	if len(response.Failures) > 0 {
+		return 0, fmt.Errorf("%d failures; first failure: %s", len(response.Failures), response.Failures[0])
+	}
+	return response.Created + response.Updated, nil
+}
+
+// WaitForTask polls the task until it completes, returning its response.
+// If the timeout, when non-zero, passes first, an error is returned; the task itself keeps running.
+func WaitForTask(client *Client, task string, timeout time.Duration) (*ByQueryResponse, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		res, err := client.Tasks.Get(task, client.Tasks.Get.WithContext(context.Background()))
+		if err != nil {
+			return nil, fmt.Errorf("error getting response: %s", err)
+		}
+		var status TaskResponse
+		if res.IsError() {
+			res.Body.Close()
+			return nil, errors.New(res.String())
+		}
+		err = json.NewDecoder(res.Body).Decode(&status)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf(err.Error())
+		}
+
+		if status.Error != nil {
+			return nil, fmt.Errorf("task (%s) failed: %s", task, status.Error)
+		}
+		if status.Completed {
+			if status.Response == nil {
+				return &ByQueryResponse{}, nil
+			}
+			return status.Response, nil
+		}
+		if timeout > 0 && time.Now().After(deadline) {
+			return nil, fmt.Errorf("task (%s) didn't complete within %s; it's still running", task, timeout)
+		}
+		time.Sleep(taskPollInterval)
+	}
+}
+
+// Count returns the number of documents in the index, refreshing it first so recent writes are counted.
+func Count(client *Client, index string) (int, error) {
+	refresh, err := client.Indices.Refresh(client.Indices.Refresh.WithIndex(index))
+	if err != nil {
+		return 0, fmt.Errorf("error getting response: %s", err)
+	}
+	refresh.Body.Close()
+	if refresh.IsError() {
+		return 0, errors.New(refresh.String())
+	}
+
+	res, err := client.Count(
+		client.Count.WithContext(context.Background()),
+		client.Count.WithIndex(index),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return 0, errors.New(res.String())
+	}
+	var count CountResponse
+	if err := json.NewDecoder(res.Body).Decode(&count); err != nil {
+		return 0, fmt.Errorf(err.Error())
+	}
+	return count.Count, nil
+}
+
+// AliasIndices returns the indices the alias points to, if any.
+func AliasIndices(client *Client, alias string) ([]string, error) {
+	res, err := client.Indices.GetAlias(
+		client.Indices.GetAlias.WithContext(context.Background()),
+		client.Indices.GetAlias.WithName(alias),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+	var aliases map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&aliases); err != nil {
+		return nil, fmt.Errorf(err.Error())
+	}
+	var indices []string
+	for index := range aliases {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
+
+// AliasAction is a single action of an atomic alias update, e.g. {"add": {"index": "events-2", "alias": "events"}}.
+type AliasAction map[string]map[string]interface{}
+
+func AddAlias(index string, alias string) AliasAction {
+	return AliasAction{"add": {"index": index, "alias": alias}}
+}
+
+func RemoveAlias(index string, alias string) AliasAction {
+	return AliasAction{"remove": {"index": index, "alias": alias}}
+}
+
+// UpdateAliases applies the actions atomically.
+func UpdateAliases(client *Client, actions []AliasAction) error {
+	marshal, err := json.Marshal(map[string]interface{}{
+		"actions": actions,
+	})
+	if err != nil {
+		return err
+	}
+	res, err := client.Indices.UpdateAliases(
+		bytes.NewReader(marshal),
+		client.Indices.UpdateAliases.WithContext(context.Background()),
+	)
+	if err != nil {
+		return fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+	return nil
+}
+
+// MoveAlias points the alias at the indices alone, removing it from any other indices in the same update.
+func MoveAlias(client *Client, alias string, indices ...string) error {
+	current, err := AliasIndices(client, alias)
+	if err != nil {
+		return err
+	}
+	keep := map[string]bool{}
+	for _, index := range indices {
+		keep[index] = true
+	}
+	var actions []AliasAction
+	for _, previous := range current {
+		if !keep[previous] {
+			actions = append(actions, RemoveAlias(previous, alias))
+		}
+	}
+	for _, index := range indices {
+		actions = append(actions, AddAlias(index, alias))
+	}
+	return UpdateAliases(client, actions)
+}
+
+// RolloverConditions are the thresholds any of which trigger a rollover; none rolls over unconditionally.
+type RolloverConditions struct {
+	MaxAge  string `json:"max_age,omitempty"`
+	MaxDocs int    `json:"max_docs,omitempty"`
+	MaxSize string `json:"max_size,omitempty"`
+}
+
+type RolloverResponse struct {
+	OldIndex   string          `json:"old_index"`
+	NewIndex   string          `json:"new_index"`
+	RolledOver bool            `json:"rolled_over"`
+	DryRun     bool            `json:"dry_run"`
+	Conditions map[string]bool `json:"conditions"`
+}
+
+// Rollover rolls the write alias over to a new index if any of the conditions are met.
+// The new index is named by incrementing the old index's numeric suffix unless given.
+func Rollover(client *Client, alias string, conditions *RolloverConditions, newIndex string) (*RolloverResponse, error) {
+	body := map[string]interface{}{}
+	if conditions != nil && *conditions != (RolloverConditions{}) {
+		body["conditions"] = conditions
+	}
+	marshal, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	opts := []func(*esapi.IndicesRolloverRequest){
+		client.Indices.Rollover.WithContext(context.Background()),
+		client.Indices.Rollover.WithBody(bytes.NewReader(marshal)),
+	}
+	if newIndex != "" {
+		opts = append(opts, client.Indices.Rollover.WithNewIndex(newIndex))
+	}
+	res, err := client.Indices.Rollover(alias, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+	var rollover RolloverResponse
+	if err := json.NewDecoder(res.Body).Decode(&rollover); err != nil {
+		return nil, fmt.Errorf(err.Error())
+	}
+	return &rollover, nil
+}
+
+// IndexInfo is an index's summary as listed by the cat indices API, which reports every value as a string.
+type IndexInfo struct {
+	Index        string `json:"index"`
+	Health       string `json:"health"`
+	Status       string `json:"status"`
+	DocsCount    string `json:"docs.count"`
+	CreationDate string `json:"creation.date"`
+}
+
+// CatIndices lists the open indices matching the pattern, ordered by creation date.
+func CatIndices(client *Client, pattern string) ([]IndexInfo, error) {
+	res, err := client.Cat.Indices(
+		client.Cat.Indices.WithContext(context.Background()),
+		client.Cat.Indices.WithIndex(pattern),
+		client.Cat.Indices.WithFormat("json"),
+		client.Cat.Indices.WithH("index", "health", "status", "docs.count", "creation.date"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+	var indices []IndexInfo
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf(err.Error())
+	}
+
+	var open []IndexInfo
+	for _, index := range indices {
+		if index.Status == "open" {
+			open = append(open, index)
+		}
+	}
+	sort.SliceStable(open, func(i, j int) bool {
+		a, _ := strconv.ParseInt(open[i].CreationDate, 10, 64)
+		b, _ := strconv.ParseInt(open[j].CreationDate, 10, 64)
+		if a != b {
+			return a < b
+		}
+		return open[i].Index < open[j].Index
+	})
+	return open, nil
+}
+
+// IndexDetails holds the index's settings, mappings and stats as reported by their APIs.
+type IndexDetails struct {
+	Settings json.RawMessage
+	Mappings json.RawMessage
+	Stats    json.RawMessage
+}
+
+// GetIndexDetails fetches the index's settings, mappings and stats, returning nil if the index doesn't exist.
+func GetIndexDetails(client *Client, index string) (*IndexDetails, error) {
+	settings, err := client.Indices.GetSettings(
+		client.Indices.GetSettings.WithContext(context.Background()),
+		client.Indices.GetSettings.WithIndex(index),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	if settings.StatusCode == 404 {
+		settings.Body.Close()
+		return nil, nil
+	}
+	var details IndexDetails
+	if details.Settings, err = indexEntry(settings, index, "settings"); err != nil {
+		return nil, err
+	}
+
+	mappings, err := client.Indices.GetMapping(
+		client.Indices.GetMapping.WithContext(context.Background()),
+		client.Indices.GetMapping.WithIndex(index),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	if details.Mappings, err = indexEntry(mappings, index, "mappings"); err != nil {
+		return nil, err
+	}
+
+	stats, err := client.Indices.Stats(
+		client.Indices.Stats.WithContext(context.Background()),
+		client.Indices.Stats.WithIndex(index),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	var statsByIndex struct {
+		Indices map[string]json.RawMessage `json:"indices"`
+	}
+	if err := decodeIndexResponse(stats, &statsByIndex); err != nil {
+		return nil, err
+	}
+	details.Stats = statsByIndex.Indices[index]
+	return &details, nil
+}
+
+// indexEntry picks the index's key out of a response keyed by index name, e.g. {"events": {"settings": {...}}}.
+func indexEntry(res *esapi.Response, index string, key string) (json.RawMessage, error) {
+	var byIndex map[string]map[string]json.RawMessage
+	if err := decodeIndexResponse(res, &byIndex); err != nil {
+		return nil, err
+	}
+	return byIndex[index][key], nil
+}
+
+func decodeIndexResponse(res *esapi.Response, v interface{}) error {
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package es
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReindex(t *testing.T) {
+	taskPollInterval = 100 * time.Millisecond
+	es := NewTestClient()
+
+	source, err := NewIndex(es, "reindexsource", nil)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, source))
+	for i := 0; i < 3; i++ {
+		res, err := es.Create(source, strconv.Itoa(i), strings.NewReader(fmt.Sprintf(`{"timestamp": "2020-05-10T0%d:00:00.000Z"}`, i)))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if res.IsError() {
+			t.Fatal(res.String())
+			return
+		}
+	}
+
+	dest := NewIndexName("reindexdest")
+	err = CreateIndex(es, dest, map[string]PropertyMapping{"timestamp": {Type: "date"}}, []string{"timestamp"})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, dest))
+
+	t.Run("Reindex and count", func(t *testing.T) {
+		reindexed, err := Reindex(es, source, dest, time.Minute)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if reindexed != 3 {
+			t.Errorf("Expected 3 documents reindexed; got %d", reindexed)
+			return
+		}
+		count, err := Count(es, dest)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if count != 3 {
+			t.Errorf("Expected 3 documents; got %d", count)
+			return
+		}
+		document, err := FindById(es, dest, "2", "", Fields{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if document == nil {
+			t.Error("Expected the original IDs to be kept")
+			return
+		}
+	})
+
+	t.Run("Create from the source's mappings", func(t *testing.T) {
+		copied := NewIndexName("reindexcopy")
+		err := CreateIndexFrom(es, copied, source, map[string]PropertyMapping{"count": {Type: "long"}}, []string{"timestamp"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		t.Cleanup(CleanupIndex(t, es, copied))
+		details, err := GetIndexDetails(es, copied)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mappings := string(details.Mappings)
+		if !strings.Contains(mappings, `"timestamp":{"type":"date"}`) || !strings.Contains(mappings, `"count":{"type":"long"}`) {
+			t.Errorf("Expected the source's timestamp and the mapped count; got %s", mappings)
+			return
+		}
+	})
+
+	t.Run("Move alias", func(t *testing.T) {
+		alias := NewIndexName("reindexalias")
+		if err := MoveAlias(es, alias, source); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := MoveAlias(es, alias, dest); err != nil {
+			t.Error(err)
+			return
+		}
+		indices, err := AliasIndices(es, alias)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(indices) != 1 || indices[0] != dest {
+			t.Errorf("Expected the alias to point at %s alone; got %v", dest, indices)
+			return
+		}
+	})
+}
+
+func TestRollover(t *testing.T) {
+	es := NewTestClient()
+
+	prefix := NewIndexName("rollover")
+	alias := prefix + "-write"
+	res, err := es.Indices.Create(prefix+"-000001", es.Indices.Create.WithBody(strings.NewReader(`{"aliases":{"`+alias+`":{"is_write_index":true}}}`)))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if res.IsError() {
+		t.Fatal(res.String())
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, prefix+"-*"))
+
+	t.Run("Conditions not met", func(t *testing.T) {
+		rollover, err := Rollover(es, alias, &RolloverConditions{MaxDocs: 1}, "")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if rollover.RolledOver || rollover.OldIndex != prefix+"-000001" {
+			t.Errorf("Expected no rollover; got %v", rollover)
+			return
+		}
+	})
+
+	t.Run("Unconditional", func(t *testing.T) {
+		rollover, err := Rollover(es, alias, nil, "")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !rollover.RolledOver || rollover.NewIndex != prefix+"-000002" {
+			t.Errorf("Expected a rollover to %s-000002; got %v", prefix, rollover)
+			return
+		}
+	})
+}
+
+func TestCatIndices(t *testing.T) {
+	es := NewTestClient()
+
+	prefix := NewIndexName("catindices")
+	for _, suffix := range []string{"b", "a"} {
+		res, err := es.Indices.Create(prefix + "-" + suffix)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if res.IsError() {
+			t.Fatal(res.String())
+			return
+		}
+		// creation dates have millisecond precision
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Cleanup(CleanupIndex(t, es, prefix+"-*"))
+
+	t.Run("Creation order", func(t *testing.T) {
+		indices, err := CatIndices(es, prefix+"-*")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(indices) != 2 || indices[0].Index != prefix+"-b" || indices[1].Index != prefix+"-a" {
+			t.Errorf("Expected both indices in creation order; got %v", indices)
+			return
+		}
+		if !ValidHealth(indices[0].Health) || indices[0].DocsCount != "0" {
+			t.Errorf("Expected the index's health and doc count; got %v", indices[0])
+			return
+		}
+	})
+
+	t.Run("Details", func(t *testing.T) {
+		details, err := GetIndexDetails(es, prefix+"-a")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if details == nil || details.Settings == nil || details.Mappings == nil || details.Stats == nil {
+			t.Errorf("Expected settings, mappings and stats; got %v", details)
+			return
+		}
+		details, err = GetIndexDetails(es, prefix+"-missing")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if details != nil {
+			t.Error("Expected no details for a missing index")
+			return
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package es
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	elastic "github.com/elastic/go-elasticsearch/v7"
+	"strconv"
+	"strings"
+)
+
+const (
+	FlavorElasticsearch = "elasticsearch"
+	FlavorOpenSearch    = "opensearch"
+)
+
+// Client is an elastic client along with what's known of the cluster it's connected to.
+type Client struct {
+	*elastic.Client
+	Info         ClusterInfo
+	Capabilities Capabilities
+}
+
+type ClusterInfo struct {
+	Name    string `json:"cluster_name"`
+	Tagline string `json:"tagline"`
+	Version struct {
+		Number       string `json:"number"`
+		Distribution string `json:"distribution,omitempty"`
+	} `json:"version"`
+}
+
+// Capabilities are the features of the cluster's version which queries and responses differ on.
+type Capabilities struct {
+	Flavor string
+	Major  int
+	Minor  int
+	// mappings and document APIs no longer take a type (7.0+); 6.x uses _doc
+	Typeless bool
+	// hits.total is an object and track_total_hits is accepted (7.0+); 6.x uses a plain number
+	TotalHitsObject bool
+	// date_histogram takes calendar_interval/fixed_interval rather than interval (7.2+)
+	CalendarInterval bool
+	// searches may return _seq_no and _primary_term (6.7+)
+	SeqNoPrimaryTerm bool
+	// searches can be pinned to a point in time (7.10+; OpenSearch 2.4+)
+	PointInTime bool
+	// the _shard_doc tiebreaker is sortable within a point in time (7.12+; not OpenSearch)
+	ShardDoc bool
+	// _id is sortable, which 8.x disallows by default
+	IdSort bool
+}
+
+func newClusterInfo(client *elastic.Client) (ClusterInfo, error) {
+	var info ClusterInfo
+	res, err := client.Info()
+	if err != nil {
+		return info, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return info, errors.New(res.String())
+	}
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return info, fmt.Errorf("error decoding cluster info: %s", err)
+	}
+	return info, nil
+}
+
+// DetectFlavor determines whether the cluster is Elasticsearch or OpenSearch from its info.
+func (i ClusterInfo) DetectFlavor() string {
+	if i.Version.Distribution == FlavorOpenSearch || strings.Contains(i.Tagline, "OpenSearch") {
+		return FlavorOpenSearch
+	}
+	return FlavorElasticsearch
+}
+
+// NewCapabilities determines the cluster's capabilities from its info.
+// The flavor overrides detection if set.
+func NewCapabilities(info ClusterInfo, flavor string) (Capabilities, error) {
+	if flavor == "" {
+		flavor = info.DetectFlavor()
+	} else if flavor != FlavorElasticsearch && flavor != FlavorOpenSearch {
+		return Capabilities{}, fmt.Errorf("invalid flavor: %s", flavor)
+	}
+	capabilities := Capabilities{
+		Flavor: flavor,
+	}
+
+	var err error
+	parts := strings.SplitN(info.Version.Number, ".", 3)
+	if len(parts) < 2 {
+		return capabilities, fmt.Errorf("unrecognized cluster version: %s", info.Version.Number)
+	}
+	if capabilities.Major, err = strconv.Atoi(parts[0]); err != nil {
+		return capabilities, fmt.Errorf("unrecognized cluster version: %s", info.Version.Number)
+	}
+	if capabilities.Minor, err = strconv.Atoi(parts[1]); err != nil {
+		return capabilities, fmt.Errorf("unrecognized cluster version: %s", info.Version.Number)
+	}
+
+	switch capabilities.Flavor {
+	case FlavorOpenSearch:
+		if capabilities.Major == 7 && capabilities.Minor == 10 {
+			// compatibility.override_main_response_version reports the 7.10.2 fork point
+			capabilities.Major, capabilities.Minor = 1, 0
+		} else if capabilities.Major < 1 || capabilities.Major > 2 {
+			return capabilities, fmt.Errorf("unsupported opensearch version: %s", info.Version.Number)
+		}
+		// forked from 7.10.2
+		capabilities.Typeless = true
+		capabilities.TotalHitsObject = true
+		capabilities.CalendarInterval = true
+		capabilities.SeqNoPrimaryTerm = true
+		capabilities.IdSort = true
+		// through its own point in time API
+		capabilities.PointInTime = capabilities.AtLeast(2, 4)
+	default:
+		if capabilities.Major < 6 || capabilities.Major > 8 {
+			return capabilities, fmt.Errorf("unsupported elasticsearch version: %s", info.Version.Number)
+		}
+		capabilities.Typeless = capabilities.AtLeast(7, 0)
+		capabilities.TotalHitsObject = capabilities.AtLeast(7, 0)
+		capabilities.CalendarInterval = capabilities.AtLeast(7, 2)
+		capabilities.SeqNoPrimaryTerm = capabilities.AtLeast(6, 7)
+		capabilities.PointInTime = capabilities.AtLeast(7, 10)
+		capabilities.ShardDoc = capabilities.AtLeast(7, 12)
+		capabilities.IdSort = !capabilities.AtLeast(8, 0)
+	}
+	return capabilities, nil
+}
+
+func (c Capabilities) AtLeast(major int, minor int) bool {
+	return c.Major > major || (c.Major == major && c.Minor >= minor)
+}
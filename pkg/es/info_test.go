@@ -0,0 +1,98 @@
+package es
+
+import "testing"
+
+func newTestCapabilities(t *testing.T, distribution string, number string) Capabilities {
+	info := ClusterInfo{}
+	info.Version.Distribution = distribution
+	info.Version.Number = number
+	capabilities, err := NewCapabilities(info, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return capabilities
+}
+
+func TestNewCapabilities(t *testing.T) {
+	t.Run("Elasticsearch 6", func(t *testing.T) {
+		capabilities := newTestCapabilities(t, "", "6.8.23")
+		if capabilities.Typeless || capabilities.TotalHitsObject || capabilities.CalendarInterval {
+			t.Errorf("6.8 predates typeless APIs, total hits objects and calendar intervals: %+v", capabilities)
+			return
+		}
+		if !capabilities.SeqNoPrimaryTerm {
+			t.Error("6.8 supports seq_no_primary_term")
+			return
+		}
+	})
+
+	t.Run("Point in time", func(t *testing.T) {
+		if newTestCapabilities(t, "", "7.6.2").PointInTime {
+			t.Error("7.6 doesn't support point in time")
+			return
+		}
+		if !newTestCapabilities(t, "", "7.10.0").PointInTime {
+			t.Error("7.10 supports point in time")
+			return
+		}
+		if !newTestCapabilities(t, "", "8.0.0-SNAPSHOT").ShardDoc {
+			t.Error("8.0 supports _shard_doc")
+			return
+		}
+		if newTestCapabilities(t, "", "8.0.0-SNAPSHOT").IdSort {
+			t.Error("8.0 disallows sorting on _id")
+			return
+		}
+	})
+
+	t.Run("OpenSearch", func(t *testing.T) {
+		capabilities := newTestCapabilities(t, FlavorOpenSearch, "2.11.0")
+		if capabilities.Flavor != FlavorOpenSearch || !capabilities.Typeless {
+			t.Errorf("Unexpected capabilities: %+v", capabilities)
+			return
+		}
+	})
+
+	t.Run("OpenSearch compatibility mode", func(t *testing.T) {
+		info := ClusterInfo{Tagline: "The OpenSearch Project: https://opensearch.org/"}
+		info.Version.Number = "7.10.2"
+		capabilities, err := NewCapabilities(info, "")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if capabilities.Flavor != FlavorOpenSearch || capabilities.PointInTime {
+			t.Errorf("Expected OpenSearch 1.x capabilities; got %+v", capabilities)
+			return
+		}
+	})
+
+	t.Run("Flavor override", func(t *testing.T) {
+		info := ClusterInfo{}
+		info.Version.Number = "2.11.0"
+		capabilities, err := NewCapabilities(info, FlavorOpenSearch)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !capabilities.PointInTime || capabilities.ShardDoc {
+			t.Errorf("Expected OpenSearch 2.11 capabilities; got %+v", capabilities)
+			return
+		}
+		if _, err := NewCapabilities(info, "solr"); err == nil {
+			t.Error("Should be an invalid flavor")
+			return
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		for _, number := range []string{"latest", "5.6.16", "9.0.0"} {
+			info := ClusterInfo{}
+			info.Version.Number = number
+			if _, err := NewCapabilities(info, ""); err == nil {
+				t.Errorf("%s should be unsupported", number)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package es
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	MetricCount       = "count"
+	MetricAvg         = "avg"
+	MetricMin         = "min"
+	MetricMax         = "max"
+	MetricSum         = "sum"
+	MetricPercentiles = "percentiles"
+)
+
+// Threshold is a condition on a metric computed over a sliding time window.
+type Threshold struct {
+	Metric    string  `json:"metric,omitempty"`
+	Field     string  `json:"field,omitempty"`
+	Percent   float64 `json:"percent,omitempty"`
+	TimeField string  `json:"time_field"`
+	Window    string  `json:"window"`
+	Operator  string  `json:"operator"`
+	Value     float64 `json:"value"`
+}
+
+func (t *Threshold) Validate() error {
+	switch t.Metric {
+	case "", MetricCount:
+	case MetricAvg, MetricMin, MetricMax, MetricSum:
+		if t.Field == "" {
+			return fmt.Errorf("%s requires a field", t.Metric)
+		}
+	case MetricPercentiles:
+		if t.Field == "" || t.Percent <= 0 || t.Percent > 100 {
+			return fmt.Errorf("percentiles requires a field and a percent in (0, 100]")
+		}
+	default:
+		return fmt.Errorf("invalid metric: %s", t.Metric)
+	}
+	switch t.Operator {
+	case "gt", "gte", "lt", "lte":
+	default:
+		return fmt.Errorf("invalid operator: %s", t.Operator)
+	}
+	if t.TimeField == "" {
+		return fmt.Errorf("threshold time_field required")
+	}
+	if _, err := t.WindowDuration(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *Threshold) WindowDuration() (time.Duration, error) {
+	window, err := time.ParseDuration(t.Window)
+	if err != nil {
+		return 0, fmt.Errorf("invalid threshold window: %s", err)
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("threshold window must be positive")
+	}
+	return window, nil
+}
+
+// Exceeded evaluates the threshold's condition against the value.
+func (t *Threshold) Exceeded(value float64) bool {
+	switch t.Operator {
+	case "gt":
+		return value > t.Value
+	case "gte":
+		return value >= t.Value
+	case "lt":
+		return value < t.Value
+	case "lte":
+		return value <= t.Value
+	}
+	return false
+}
+
+// MetricValue computes the threshold's metric over the documents in [start, end).
+// Metrics over an empty window are 0.
+func MetricValue(client *Client, index string, threshold *Threshold, filter Filter, start time.Time, end time.Time) (float64, error) {
+	window := map[string]interface{}{
+		"range": map[string]interface{}{
+			threshold.TimeField: map[string]interface{}{
+				"gte":    start.UTC().Format(time.RFC3339Nano),
+				"lt":     end.UTC().Format(time.RFC3339Nano),
+				"format": "strict_date_optional_time",
+			},
+		},
+	}
+	query := map[string]interface{}{
+		"query": filter.apply(window),
+		"size":  0,
+	}
+	if client.Capabilities.TotalHitsObject {
+		// 6.x always counts every hit
+		query["track_total_hits"] = true
+	}
+	switch threshold.Metric {
+	case "", MetricCount:
+	case MetricPercentiles:
+		query["aggs"] = map[string]interface{}{
+			"metric": map[string]interface{}{
+				MetricPercentiles: map[string]interface{}{
+					"field":    threshold.Field,
+					"percents": []float64{threshold.Percent},
+				},
+			},
+		}
+	default:
+		query["aggs"] = map[string]interface{}{
+			"metric": map[string]interface{}{
+				threshold.Metric: map[string]interface{}{
+					"field": threshold.Field,
+				},
+			},
+		}
+	}
+
+	envelope, err := search(client, index, query)
+	if err != nil {
+		return 0, err
+	}
+
+	switch threshold.Metric {
+	case "", MetricCount:
+		return float64(envelope.Hits.Total.Value), nil
+	case MetricPercentiles:
+		for _, value := range envelope.Aggregations.Metric.Values {
+			if value == nil {
+				return 0, nil
+			}
+			return *value, nil
+		}
+		return 0, nil
+	default:
+		if envelope.Aggregations.Metric.Value == nil {
+			return 0, nil
+		}
+		return *envelope.Aggregations.Metric.Value, nil
+	}
+}
+
+// FormatValue renders a metric value for use in a version.
+func FormatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
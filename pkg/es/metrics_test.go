@@ -0,0 +1,61 @@
+package es
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThreshold(t *testing.T) {
+	t.Run("Validate", func(t *testing.T) {
+		valid := []Threshold{
+			{TimeField: "timestamp", Window: "15m", Operator: "gt", Value: 100},
+			{Metric: MetricAvg, Field: "latency", TimeField: "timestamp", Window: "1h", Operator: "gte", Value: 1.5},
+			{Metric: MetricPercentiles, Field: "latency", Percent: 99, TimeField: "timestamp", Window: "5m", Operator: "lt", Value: 1},
+		}
+		for _, threshold := range valid {
+			if err := threshold.Validate(); err != nil {
+				t.Errorf("%v should be valid: %s", threshold, err)
+				return
+			}
+		}
+		invalid := []Threshold{
+			{Window: "15m", Operator: "gt"},
+			{TimeField: "timestamp", Window: "soon", Operator: "gt"},
+			{TimeField: "timestamp", Window: "15m", Operator: "about"},
+			{Metric: MetricMax, TimeField: "timestamp", Window: "15m", Operator: "gt"},
+			{Metric: MetricPercentiles, Field: "latency", TimeField: "timestamp", Window: "15m", Operator: "gt"},
+		}
+		for _, threshold := range invalid {
+			if err := threshold.Validate(); err == nil {
+				t.Errorf("%v should be invalid", threshold)
+				return
+			}
+		}
+	})
+
+	t.Run("Exceeded", func(t *testing.T) {
+		threshold := Threshold{Operator: "gt", Value: 100}
+		if threshold.Exceeded(100) || !threshold.Exceeded(101) {
+			t.Error("gt should be exclusive")
+			return
+		}
+		threshold = Threshold{Operator: "lte", Value: 0.5}
+		if !threshold.Exceeded(0.5) || threshold.Exceeded(0.6) {
+			t.Error("lte should be inclusive")
+			return
+		}
+	})
+
+	t.Run("Window", func(t *testing.T) {
+		threshold := Threshold{Window: "15m"}
+		window, err := threshold.WindowDuration()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if window != 15*time.Minute {
+			t.Errorf("Expected 15m; got %s", window)
+			return
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package es
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"net/http"
+	"net/url"
+)
+
+// how long a point in time is kept between pages
+const pitKeepAlive = "1m"
+
+// the point in time APIs postdate the client, so requests are made directly
+func perform(client *Client, method string, path string, query url.Values, body interface{}) (*esapi.Response, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, fmt.Errorf("error encoding body: %s", err)
+		}
+	}
+	req, err := http.NewRequest(method, (&url.URL{Path: path, RawQuery: query.Encode()}).String(), &buf)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := client.Perform(req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	return &esapi.Response{
+		StatusCode: res.StatusCode,
+		Body:       res.Body,
+		Header:     res.Header,
+	}, nil
+}
+
+// openPointInTime pins the index's current state for consistent paging, returning the point in time's ID.
+func openPointInTime(client *Client, index string) (string, error) {
+	path := "/" + index + "/_pit"
+	if client.Capabilities.Flavor == FlavorOpenSearch {
+		path = "/" + index + "/_search/point_in_time"
+	}
+	res, err := perform(client, http.MethodPost, path, url.Values{"keep_alive": {pitKeepAlive}}, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return "", errors.New(res.String())
+	}
+
+	var pit struct {
+		Id    string `json:"id"`
+		PitId string `json:"pit_id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&pit); err != nil {
+		return "", fmt.Errorf(err.Error())
+	}
+	if client.Capabilities.Flavor == FlavorOpenSearch {
+		return pit.PitId, nil
+	}
+	return pit.Id, nil
+}
+
+func closePointInTime(client *Client, id string) error {
+	var res *esapi.Response
+	var err error
+	if client.Capabilities.Flavor == FlavorOpenSearch {
+		res, err = perform(client, http.MethodDelete, "/_search/point_in_time", nil, map[string]interface{}{
+			"pit_id": []string{id},
+		})
+	} else {
+		res, err = perform(client, http.MethodDelete, "/_pit", nil, map[string]interface{}{
+			"id": id,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+	return nil
+}
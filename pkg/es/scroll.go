@@ -0,0 +1,111 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// how long a scroll is kept between pages
+const scrollKeepAlive = time.Minute
+
+// scrollPages passes each page of the sorted query's hits, read with a scroll, to the page func, stopping at the
+// limit if non-zero. Like a point in time, the scroll keeps the index's state as of the first page,
+// but it's supported on clusters predating points in time and across clusters.
+func scrollPages(client *Client, index string, query map[string]interface{}, limit int, page func([]Hit) error) error {
+	// a scroll's page size is fixed by its first page
+	size := pageSize
+	if limit > 0 && limit < size {
+		size = limit
+	}
+	query["size"] = size
+
+	envelope, err := search(client, index, query, client.Search.WithScroll(scrollKeepAlive))
+	if err != nil {
+		return err
+	}
+	id := envelope.ScrollId
+	defer func() {
+		// the scroll expires regardless; clearing just frees it sooner
+		if err := clearScroll(client, id); err != nil {
+			log.Printf("Error clearing scroll: %s", err)
+		}
+	}()
+
+	total := 0
+	for {
+		hits := envelope.Hits.Hits
+		if limit > 0 && total+len(hits) > limit {
+			hits = hits[:limit-total]
+		}
+		total += len(hits)
+		if len(hits) > 0 {
+			if err := page(hits); err != nil {
+				return err
+			}
+		}
+		if len(envelope.Hits.Hits) < size || (limit > 0 && total >= limit) {
+			return nil
+		}
+
+		testHookPage()
+		envelope, err = scroll(client, id)
+		if err != nil {
+			return err
+		}
+		if envelope.ScrollId != "" {
+			// the scroll's ID may change between pages
+			id = envelope.ScrollId
+		}
+	}
+}
+
+// scroll fetches the scroll's next page.
+func scroll(client *Client, id string) (*EnvelopeResponse, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{
+		"scroll":    scrollKeepAlive.String(),
+		"scroll_id": id,
+	}); err != nil {
+		return nil, fmt.Errorf("error encoding query: %s", err)
+	}
+	res, err := client.Scroll(
+		client.Scroll.WithContext(context.Background()),
+		client.Scroll.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+
+	var envelope EnvelopeResponse
+	if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf(err.Error())
+	}
+	return &envelope, nil
+}
+
+func clearScroll(client *Client, id string) error {
+	if id == "" {
+		return nil
+	}
+	res, err := client.ClearScroll(
+		client.ClearScroll.WithContext(context.Background()),
+		client.ClearScroll.WithScrollID(id),
+	)
+	if err != nil {
+		return fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"sort"
+)
+
+// SnapshotSuccess is the state of a completed snapshot; only these are tracked.
+const SnapshotSuccess = "SUCCESS"
+
+type Snapshot struct {
+	Snapshot          string   `json:"snapshot"`
+	UUID              string   `json:"uuid,omitempty"`
+	State             string   `json:"state,omitempty"`
+	Indices           []string `json:"indices,omitempty"`
+	StartTimeInMillis int64    `json:"start_time_in_millis,omitempty"`
+	EndTimeInMillis   int64    `json:"end_time_in_millis,omitempty"`
+	Shards            Shards   `json:"shards"`
+}
+
+type Shards struct {
+	Total      int `json:"total"`
+	Failed     int `json:"failed"`
+	Successful int `json:"successful"`
+}
+
+// SnapshotResponse is returned by creating or restoring a snapshot; Snapshot is only set when waiting for completion.
+type SnapshotResponse struct {
+	Accepted bool      `json:"accepted,omitempty"`
+	Snapshot *Snapshot `json:"snapshot,omitempty"`
+}
+
+type SnapshotsResponse struct {
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+// CreateSnapshot snapshots the indices, or the whole cluster if none are given, into the repository.
+// The snapshot is only returned when waiting for completion.
+func CreateSnapshot(client *Client, repository string, name string, indices []string, wait bool) (*Snapshot, error) {
+	body := map[string]interface{}{}
+	if len(indices) > 0 {
+		body["indices"] = indices
+	}
+	marshal, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Snapshot.Create(
+		repository,
+		name,
+		client.Snapshot.Create.WithContext(context.Background()),
+		client.Snapshot.Create.WithBody(bytes.NewReader(marshal)),
+		client.Snapshot.Create.WithWaitForCompletion(wait),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	return decodeSnapshot(res)
+}
+
+// RestoreSnapshot restores the indices, or all of the snapshot's if none are given, renaming them if a pattern is given.
+// The restored snapshot is only returned when waiting for completion.
+func RestoreSnapshot(client *Client, repository string, name string, indices []string, renamePattern string, renameReplacement string, wait bool) (*Snapshot, error) {
+	body := map[string]interface{}{}
+	if len(indices) > 0 {
+		body["indices"] = indices
+	}
+	if renamePattern != "" {
+		body["rename_pattern"] = renamePattern
+		body["rename_replacement"] = renameReplacement
+	}
+	marshal, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Snapshot.Restore(
+		repository,
+		name,
+		client.Snapshot.Restore.WithContext(context.Background()),
+		client.Snapshot.Restore.WithBody(bytes.NewReader(marshal)),
+		client.Snapshot.Restore.WithWaitForCompletion(wait),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	return decodeSnapshot(res)
+}
+
+func decodeSnapshot(res *esapi.Response) (*Snapshot, error) {
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+	var response SnapshotResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf(err.Error())
+	}
+	if response.Snapshot != nil && response.Snapshot.Shards.Failed > 0 {
+		return nil, fmt.Errorf("snapshot (%s) failed on %d of %d shards", response.Snapshot.Snapshot, response.Snapshot.Shards.Failed, response.Snapshot.Shards.Total)
+	}
+	return response.Snapshot, nil
+}
+
+// Snapshots lists the named snapshots in the repository, or all of them if none are named, ordered by start time.
+// Missing snapshots are ignored.
+func Snapshots(client *Client, repository string, names ...string) ([]Snapshot, error) {
+	if len(names) == 0 {
+		names = []string{"_all"}
+	}
+	res, err := client.Snapshot.Get(
+		repository,
+		names,
+		client.Snapshot.Get.WithContext(context.Background()),
+		client.Snapshot.Get.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting response: %s", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, errors.New(res.String())
+	}
+	var response SnapshotsResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf(err.Error())
+	}
+	sort.SliceStable(response.Snapshots, func(i, j int) bool {
+		return response.Snapshots[i].StartTimeInMillis < response.Snapshots[j].StartTimeInMillis
+	})
+	return response.Snapshots, nil
+}
+
+// SuccessfulSnapshots filters out failed, partial and in-progress snapshots.
+func SuccessfulSnapshots(snapshots []Snapshot) []Snapshot {
+	var successful []Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.State == SnapshotSuccess {
+			successful = append(successful, snapshot)
+		}
+	}
+	return successful
+}
+
+// SnapshotsSince returns the successful snapshots from the named one onwards, or only the latest if it's not found.
+func SnapshotsSince(snapshots []Snapshot, name string) []Snapshot {
+	successful := SuccessfulSnapshots(snapshots)
+	for i, snapshot := range successful {
+		if snapshot.Snapshot == name {
+			return successful[i:]
+		}
+	}
+	if len(successful) == 0 {
+		return nil
+	}
+	return successful[len(successful)-1:]
+}
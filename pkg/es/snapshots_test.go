@@ -0,0 +1,107 @@
+package es
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnapshots(t *testing.T) {
+	es := NewTestClient()
+
+	repository := NewIndexName("snapshots")
+	res, err := es.Snapshot.CreateRepository(repository, strings.NewReader(`{"type":"fs","settings":{"location":"/usr/share/elasticsearch/snapshots/`+repository+`"}}`))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if res.IsError() {
+		t.Fatal(res.String())
+		return
+	}
+	t.Cleanup(func() {
+		if _, err := es.Snapshot.DeleteRepository([]string{repository}); err != nil {
+			t.Log(err)
+		}
+	})
+
+	index, err := NewIndex(es, "snapshotted", nil)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	t.Cleanup(CleanupIndex(t, es, index))
+
+	t.Run("Create, list and restore", func(t *testing.T) {
+		snapshot, err := CreateSnapshot(es, repository, "first", []string{index}, true)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if snapshot == nil || snapshot.State != SnapshotSuccess {
+			t.Errorf("Expected a successful snapshot; got %v", snapshot)
+			return
+		}
+
+		snapshots, err := Snapshots(es, repository)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(snapshots) != 1 || snapshots[0].Snapshot != "first" {
+			t.Errorf("Expected the snapshot to be listed; got %v", snapshots)
+			return
+		}
+
+		_, err = RestoreSnapshot(es, repository, "first", []string{index}, "(.+)", "restored-$1", true)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		t.Cleanup(CleanupIndex(t, es, "restored-"+index))
+		exists, err := IndexExists(es, "restored-"+index)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !exists {
+			t.Error("Expected the renamed index to be restored")
+			return
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		snapshots, err := Snapshots(es, repository, "missing")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(snapshots) != 0 {
+			t.Errorf("Expected no snapshots; got %v", snapshots)
+			return
+		}
+	})
+}
+
+func TestSnapshotsSince(t *testing.T) {
+	snapshots := []Snapshot{
+		{Snapshot: "a", State: SnapshotSuccess},
+		{Snapshot: "b", State: "FAILED"},
+		{Snapshot: "c", State: SnapshotSuccess},
+		{Snapshot: "d", State: SnapshotSuccess},
+	}
+
+	since := SnapshotsSince(snapshots, "a")
+	if len(since) != 3 || since[0].Snapshot != "a" || since[1].Snapshot != "c" {
+		t.Errorf("Expected the successful snapshots from a; got %v", since)
+		return
+	}
+	since = SnapshotsSince(snapshots, "gone")
+	if len(since) != 1 || since[0].Snapshot != "d" {
+		t.Errorf("Expected only the latest snapshot; got %v", since)
+		return
+	}
+	if since := SnapshotsSince(nil, ""); since != nil {
+		t.Errorf("Expected no snapshots; got %v", since)
+		return
+	}
+}
@@ -3,18 +3,92 @@ package es
 import "encoding/json"
 
 type EnvelopeResponse struct {
-	Took int
+	Took     int
+	PitId    string `json:"pit_id"`
+	ScrollId string `json:"_scroll_id"`
+	Hits     struct {
+		Total TotalHits
+		Hits  []Hit
+	}
+	Aggregations struct {
+		Versions struct {
+			Buckets []struct {
+				Key         json.RawMessage `json:"key"`
+				KeyAsString string          `json:"key_as_string"`
+				DocCount    int64           `json:"doc_count"`
+				Max         struct {
+					Value *float64 `json:"value"`
+				} `json:"max"`
+				Top struct {
+					Hits struct {
+						Hits []Hit `json:"hits"`
+					} `json:"hits"`
+				} `json:"top"`
+			} `json:"buckets"`
+			// AfterKey continues a composite aggregation from its last bucket
+			AfterKey json.RawMessage `json:"after_key,omitempty"`
+		} `json:"versions"`
+		Metric struct {
+			Value  *float64            `json:"value"`
+			Values map[string]*float64 `json:"values"`
+		} `json:"metric"`
+	} `json:"aggregations"`
+}
+
+// TotalHits is decoded from either the 7.x+ object or the 6.x plain number.
+type TotalHits struct {
+	Value int `json:"value"`
+}
+
+func (t *TotalHits) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &t.Value); err == nil {
+		return nil
+	}
+	var total struct {
+		Value int `json:"value"`
+	}
+	if err := json.Unmarshal(data, &total); err != nil {
+		return err
+	}
+	t.Value = total.Value
+	return nil
+}
+
+type Hit struct {
+	Index       string          `json:"_index"`
+	ID          string          `json:"_id"`
+	Routing     string          `json:"_routing,omitempty"`
+	SeqNo       *int64          `json:"_seq_no,omitempty"`
+	PrimaryTerm *int64          `json:"_primary_term,omitempty"`
+	Source      json.RawMessage `json:"_source"`
+	// Fields holds the requested docvalue and stored fields
+	Fields    map[string]json.RawMessage `json:"fields,omitempty"`
+	Sort      []json.RawMessage          `json:"sort,omitempty"`
+	InnerHits map[string]InnerHits       `json:"inner_hits,omitempty"`
+}
+
+// InnerHits are the hits named in a hit's inner_hits, e.g. the latest document of a collapsed group.
+type InnerHits struct {
 	Hits struct {
-		Total struct {
-			Value int
-		}
-		Hits []struct {
-			ID     string          `json:"_id"`
-			Source json.RawMessage `json:"_source"`
-		}
+		Hits []Hit
 	}
 }
 
+type WriteResponse struct {
+	ID          string `json:"_id"`
+	Result      string `json:"result"`
+	SeqNo       int64  `json:"_seq_no"`
+	PrimaryTerm int64  `json:"_primary_term"`
+}
+
+type ByQueryResponse struct {
+	Total    int               `json:"total"`
+	Created  int               `json:"created"`
+	Deleted  int               `json:"deleted"`
+	Updated  int               `json:"updated"`
+	Failures []json.RawMessage `json:"failures"`
+}
+
 type PropertyMapping struct {
 	Type string `json:"type"`
 }
@@ -0,0 +1,23 @@
+package es
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTotalHits(t *testing.T) {
+	for _, body := range []string{
+		`{"hits": {"total": 3, "hits": []}}`,
+		`{"hits": {"total": {"value": 3, "relation": "eq"}, "hits": []}}`,
+	} {
+		var envelope EnvelopeResponse
+		if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+			t.Error(err)
+			return
+		}
+		if envelope.Hits.Total.Value != 3 {
+			t.Errorf("Expected 3 total hits from %s; got %d", body, envelope.Hits.Total.Value)
+			return
+		}
+	}
+}